@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	//go:embed static/actionplan.html
+	actionPlanHTML     string
+	actionPlanTemplate = template.Must(template.New("actionplan").Funcs(templateFuncs).Parse(actionPlanHTML))
+)
+
+// Draft SMART asthma action plan for a patient
+type ActionPlan struct {
+	Language  string
+	Labels    actionPlanLabels
+	Patient   Patient
+	Product   string
+	MaxPuffs  int
+	Zones     []ActionPlanZone
+	Generated time.Time
+}
+
+type ActionPlanZone struct {
+	Color        string
+	Title        string
+	Signs        string
+	Instructions []string
+}
+
+// Text of an action plan in one language
+type actionPlanLabels struct {
+	Title      string
+	Draft      string
+	Name       string
+	MRN        string
+	BirthDate  string
+	Medication string
+	Intro      string
+	Zones      [3]actionPlanZoneText
+
+	// Card offering the plan. The detail is HTML.
+	CardSummary       string
+	CardDetail        string
+	SuggestionLabel   string
+	ActionDescription string
+}
+
+type actionPlanZoneText struct {
+	Title        string
+	Signs        string
+	Instructions []string
+}
+
+// Action plan text by language. {product}, {dose}, {reliever}, {max} and {date} are replaced with
+// the ICS-formoterol product, the maintenance and reliever doses, the maximum daily puffs and the
+// date generated.
+var actionPlanText = map[string]actionPlanLabels{
+	"en": {
+		Title:      "SMART Asthma Action Plan",
+		Draft:      "Draft generated {date}. Review with your care team.",
+		Name:       "Name",
+		MRN:        "MRN",
+		BirthDate:  "Date of birth",
+		Medication: "SMART inhaler",
+		Intro:      "One inhaler, {product}, is used every day to control asthma and also for quick relief of symptoms.",
+		Zones: [3]actionPlanZoneText{
+			{
+				Title: "Green zone: Doing well",
+				Signs: "No cough, wheeze, chest tightness or shortness of breath. Able to do usual activities and sleep through the night.",
+				Instructions: []string{
+					"Take {dose} of {product} every day, even when feeling well.",
+					"Rinse mouth with water after using the inhaler.",
+				},
+			},
+			{
+				Title: "Yellow zone: Getting worse",
+				Signs: "Cough, wheeze, chest tightness or shortness of breath, or waking at night with asthma symptoms.",
+				Instructions: []string{
+					"Take {reliever} of {product} as needed for symptoms. If needed, wait 1 to 3 minutes and take {reliever} more.",
+					"Do not take more than {max} puffs in one day, including daily puffs.",
+					"Call your doctor if you need extra puffs for more than 2 days in a row.",
+				},
+			},
+			{
+				Title: "Red zone: Medical alert",
+				Signs: "Very short of breath, medicine is not helping, trouble walking or talking, or lips or fingernails are blue or gray.",
+				Instructions: []string{
+					"Take 2 puffs of {product} now.",
+					"Call 911 or go to the emergency department now.",
+				},
+			},
+		},
+		CardSummary:       "Update the asthma action plan for SMART",
+		CardDetail:        "<p>The asthma action plan does not include SMART therapy. A draft plan using {product} with a maximum of {max} puffs a day is available.</p>",
+		SuggestionLabel:   "Add draft SMART action plan",
+		ActionDescription: "Add a draft SMART asthma action plan to the chart",
+	},
+	"es": {
+		Title:      "Plan de acción para el asma SMART",
+		Draft:      "Borrador generado el {date}. Revíselo con su equipo médico.",
+		Name:       "Nombre",
+		MRN:        "Número de historia clínica",
+		BirthDate:  "Fecha de nacimiento",
+		Medication: "Inhalador SMART",
+		Intro:      "Se usa un solo inhalador, {product}, todos los días para controlar el asma y también para el alivio rápido de los síntomas.",
+		Zones: [3]actionPlanZoneText{
+			{
+				Title: "Zona verde: Bien",
+				Signs: "Sin tos, silbido en el pecho, opresión en el pecho ni falta de aire. Puede hacer sus actividades normales y dormir toda la noche.",
+				Instructions: []string{
+					"Use {dose} de {product} todos los días, aunque se sienta bien.",
+					"Enjuáguese la boca con agua después de usar el inhalador.",
+				},
+			},
+			{
+				Title: "Zona amarilla: Empeorando",
+				Signs: "Tos, silbido en el pecho, opresión en el pecho o falta de aire, o se despierta de noche con síntomas de asma.",
+				Instructions: []string{
+					"Use {reliever} de {product} si tiene síntomas. Si es necesario, espere de 1 a 3 minutos y use {reliever} más.",
+					"No use más de {max} inhalaciones en un día, incluidas las inhalaciones diarias.",
+					"Llame a su médico si necesita inhalaciones adicionales por más de 2 días seguidos.",
+				},
+			},
+			{
+				Title: "Zona roja: Alerta médica",
+				Signs: "Mucha falta de aire, el medicamento no ayuda, dificultad para caminar o hablar, o labios o uñas azules o grises.",
+				Instructions: []string{
+					"Use 2 inhalaciones de {product} ahora.",
+					"Llame al 911 o vaya a la sala de emergencias ahora.",
+				},
+			},
+		},
+		CardSummary:       "Actualice el plan de acción para el asma con SMART",
+		CardDetail:        "<p>El plan de acción para el asma no incluye la terapia SMART. Hay un borrador de plan con {product} y un máximo de {max} inhalaciones al día.</p>",
+		SuggestionLabel:   "Agregar el borrador del plan de acción SMART",
+		ActionDescription: "Agregar un borrador del plan de acción SMART para el asma a la historia clínica",
+	},
+}
+
+// Maintenance dose written on the action plan
+func maintenanceDose(puffs int, lang string) string {
+	if lang == "es" {
+		return fmt.Sprintf("%d %s dos veces al día", puffs, plural(puffs, "inhalación", "inhalaciones"))
+	}
+	return fmt.Sprintf("%d %s twice a day", puffs, plural(puffs, "puff", "puffs"))
+}
+
+// Reliever dose written on the action plan
+func relieverDose(puffs int, lang string) string {
+	if lang == "es" {
+		return fmt.Sprintf("%d %s", puffs, plural(puffs, "inhalación", "inhalaciones"))
+	}
+	return fmt.Sprintf("%d %s", puffs, plural(puffs, "puff", "puffs"))
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// Reports whether action plans are available in a language
+func actionPlanLanguage(lang string) bool {
+	_, ok := actionPlanText[lang]
+	return ok
+}
+
+// Builds a draft SMART action plan for the patient using the given ICS-formoterol product and,
+// when the product is in the formulary, its recommended dose
+func (er *EligibilityRequest) actionPlan(lang, product string, rec *DosingRecommendation) ActionPlan {
+	if !actionPlanLanguage(lang) {
+		lang = defaultLanguage
+	}
+	labels := actionPlanText[lang]
+
+	now := clinicalNow()
+	age := yearsBetween(er.Context.Patient.BirthDate.Time, now)
+	plan := ActionPlan{
+		Language:  lang,
+		Labels:    labels,
+		Patient:   er.Context.Patient,
+		Product:   product,
+		MaxPuffs:  maxDailyPuffs(age),
+		Generated: now,
+	}
+
+	// Without a formulary product, use the step 3 dose for children and step 4 for adolescents
+	maintenance, reliever := 2, 1
+	if age < 12 {
+		maintenance = 1
+	}
+	if rec != nil {
+		maintenance, reliever = rec.MaintenancePuffs, rec.RelieverPuffs
+		plan.MaxPuffs = rec.MaxDailyPuffs
+	}
+
+	replacer := strings.NewReplacer(
+		"{product}", product,
+		"{dose}", maintenanceDose(maintenance, lang),
+		"{reliever}", relieverDose(reliever, lang),
+		"{max}", strconv.Itoa(plan.MaxPuffs),
+		"{date}", now.Format(time.DateOnly),
+	)
+	labels.Draft = replacer.Replace(labels.Draft)
+	labels.Intro = replacer.Replace(labels.Intro)
+	plan.Labels = labels
+
+	colors := [3]string{"green", "yellow", "red"}
+	for i, text := range labels.Zones {
+		zone := ActionPlanZone{
+			Color: colors[i],
+			Title: text.Title,
+			Signs: text.Signs,
+		}
+		for _, instruction := range text.Instructions {
+			zone.Instructions = append(zone.Instructions, replacer.Replace(instruction))
+		}
+		plan.Zones = append(plan.Zones, zone)
+	}
+
+	return plan
+}
+
+// Returns the name and codes of the patient's ICS-formoterol product: the latest SMART order, the
+// recommended formulary product, the tenant's SMART medication or a generic name
+func (er *EligibilityRequest) smartProduct() (string, []string) {
+	if len(er.Data.ControllerMedicationRequests) > 0 {
+		mr := er.Data.ControllerMedicationRequests[0]
+		if er.Config.Codes.ICSF.MatchString(mr.MedicationReference.VocabularyCode) {
+			return medicationName(mr), medicationCodes(mr)
+		}
+	}
+	if rec := er.recommendDose(); rec != nil && rec.Product.Medication.Display != "" {
+		return rec.Product.Medication.Display, []string{rec.Product.Medication.Code}
+	}
+	if med := er.Config.SmartMedication; med != nil && med.Display != "" {
+		return med.Display, []string{med.Code}
+	}
+	return "budesonide-formoterol", nil
+}
+
+// Renders the action plan as HTML
+func (p ActionPlan) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := actionPlanTemplate.Execute(&buf, p); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Renders the action plan as a single page PDF
+func (p ActionPlan) PDF() ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "Letter", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+
+	// Core fonts use cp1252, which covers Spanish
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	width, _ := pdf.GetPageSize()
+	width -= 30
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(width, 10, tr(p.Labels.Title), "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "I", 9)
+	pdf.CellFormat(width, 5, tr(p.Labels.Draft), "", 1, "L", false, 0, "")
+	pdf.Ln(3)
+
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(width, 7, tr(p.Labels.Name+": ______________________________"), "", 1, "L", false, 0, "")
+	patient := p.Labels.BirthDate + ": " + p.Patient.BirthDate.Format(time.DateOnly)
+	if p.Patient.MRN != "" {
+		patient = p.Labels.MRN + ": " + p.Patient.MRN + "    " + patient
+	}
+	pdf.CellFormat(width, 7, tr(patient), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(width, 7, tr(p.Labels.Medication+": "+p.Product), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(width, 6, tr(p.Labels.Intro), "", "L", false)
+	pdf.Ln(4)
+
+	fills := map[string][3]int{
+		"green":  {39, 174, 96},
+		"yellow": {241, 196, 15},
+		"red":    {192, 57, 43},
+	}
+	for _, zone := range p.Zones {
+		fill := fills[zone.Color]
+		pdf.SetFillColor(fill[0], fill[1], fill[2])
+		pdf.SetFont("Helvetica", "B", 13)
+		pdf.CellFormat(width, 9, tr(" "+zone.Title), "", 1, "L", true, 0, "")
+
+		pdf.SetFont("Helvetica", "I", 10)
+		pdf.MultiCell(width, 5.5, tr(zone.Signs), "", "L", false)
+		pdf.SetFont("Helvetica", "", 11)
+		for _, instruction := range zone.Instructions {
+			pdf.MultiCell(width, 6, tr("- "+instruction), "", "L", false)
+		}
+		pdf.Ln(4)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Adds a card offering a draft SMART action plan as a DocumentReference
+func (h *Hook) addActionPlanCard(er *EligibilityRequest, plan ActionPlan) error {
+	htmlPlan, err := plan.HTML()
+	if err != nil {
+		return err
+	}
+	pdfPlan, err := plan.PDF()
+	if err != nil {
+		return err
+	}
+
+	patId := er.Context.Patient.Id
+	document := DocumentReferenceAction{
+		ResourceType: "DocumentReference",
+		Status:       "current",
+		DocStatus:    "preliminary",
+		Type:         Category{Text: plan.Labels.Title},
+		Subject: ResourceReference{
+			Reference: fmt.Sprintf("Patient/%s", patId),
+		},
+		Date: plan.Generated.Format(time.RFC3339),
+		Content: []DocumentContent{
+			{Attachment: Attachment{ContentType: "text/html", Language: plan.Language, Data: base64.StdEncoding.EncodeToString([]byte(htmlPlan)), Title: plan.Labels.Title}},
+			{Attachment: Attachment{ContentType: "application/pdf", Language: plan.Language, Data: base64.StdEncoding.EncodeToString(pdfPlan), Title: plan.Labels.Title}},
+		},
+	}
+	if code := er.Config.ActionPlanDocumentType; code != nil {
+		document.Type.Coding = []Coding{*code}
+	}
+
+	// The card is in the plan's language
+	labels := actionPlanText[plan.Language]
+	detail := strings.NewReplacer(
+		"{product}", template.HTMLEscapeString(plan.Product),
+		"{max}", strconv.Itoa(plan.MaxPuffs),
+	).Replace(labels.CardDetail)
+
+	h.Cards = append(h.Cards, Card{
+		Summary:   labels.CardSummary,
+		Indicator: "info",
+		Extension: &Extension{
+			ContentType: "text/html",
+		},
+		Detail: detail,
+		Source: smartSource(),
+		Suggestions: []Suggestion{
+			{
+				Label: labels.SuggestionLabel,
+				Actions: []Action{
+					{
+						Type:        "create",
+						Description: labels.ActionDescription,
+						Resource:    document,
+					},
+				},
+			},
+		},
+	})
+
+	return nil
+}
+
+// Fetches the patient and the current action plan, used when only the draft orders are known
+func (er *EligibilityRequest) getActionPlanData() error {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	errCh := make(chan error, 2)
+
+	go er.getPatient(&wg, errCh, er.Headers)
+	go er.getAsthmaActionPlan(&wg, errCh, er.Headers)
+
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a draft action plan for a patient as HTML or PDF. Accepts a CDS Hooks style request with
+// the FHIR server, access token and patient.
+func actionPlanAPI(c echo.Context) error {
+	r := c.Request()
+	ctx := r.Context()
+
+	hookRequest, err := parseCDSHooksRequest(r.Body)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	er, err := newEligibilityRequest(c, hookRequest)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	if err := er.getData(er.Headers); err != nil {
+		logger(ctx, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	er.evaluate()
+
+	return er.renderActionPlan(c)
+}
+
+// Writes the action plan in the requested language (lang) and format (html or pdf)
+func (er *EligibilityRequest) renderActionPlan(c echo.Context) error {
+	lang := c.QueryParam("lang")
+	if lang == "" {
+		lang = er.Config.language()
+	}
+	if !actionPlanLanguage(lang) {
+		return c.String(http.StatusBadRequest, "unsupported language")
+	}
+	product, codes := er.smartProduct()
+	plan := er.actionPlan(lang, product, er.recommendDose(codes...))
+
+	switch strings.ToLower(c.QueryParam("format")) {
+	case "", "html":
+		body, err := plan.HTML()
+		if err != nil {
+			logger(er.Context.RequestContext, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.HTML(http.StatusOK, body)
+	case "pdf":
+		body, err := plan.PDF()
+		if err != nil {
+			logger(er.Context.RequestContext, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, `inline; filename="smart-asthma-action-plan.pdf"`)
+		return c.Blob(http.StatusOK, "application/pdf", body)
+	default:
+		return c.String(http.StatusBadRequest, "unsupported format")
+	}
+}
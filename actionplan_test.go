@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestActionPlanCardLanguage(t *testing.T) {
+	er := &EligibilityRequest{Config: &Config{Name: "test"}, Data: &Data{}}
+	er.Context.Patient = Patient{Id: "p"}
+
+	for _, lang := range []string{"en", "es"} {
+		t.Run(lang, func(t *testing.T) {
+			var h Hook
+			plan := er.actionPlan(lang, "budesonide-formoterol <80-4.5>", nil)
+			if err := h.addActionPlanCard(er, plan); err != nil {
+				t.Fatal(err)
+			}
+			card := h.Cards[0]
+			labels := actionPlanText[lang]
+			if card.Summary != labels.CardSummary || card.Suggestions[0].Label != labels.SuggestionLabel {
+				t.Errorf("card is not in %s: %q, %q", lang, card.Summary, card.Suggestions[0].Label)
+			}
+			if !strings.Contains(card.Detail, "budesonide-formoterol &lt;80-4.5&gt;") {
+				t.Errorf("product is not escaped in the detail: %s", card.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Days of supply assumed for a fill when neither the dispense nor the order records one
+const defaultDaysSupply int = 30
+
+type MedicationDispense struct {
+	ResourceType            string              `json:"resourcetype"`
+	Id                      string              `json:"id"`
+	Status                  string              `json:"status"`
+	MedicationReference     MedicationReference `json:"medicationReference"`
+	MedicationCode          Category            `json:"medicationCodeableConcept"`
+	AuthorizingPrescription []ResourceReference `json:"authorizingPrescription"`
+	Quantity                Quantity            `json:"quantity"`
+	DaysSupply              Quantity            `json:"daysSupply"`
+	WhenHandedOver          Date                `json:"whenHandedOver"`
+}
+
+// Controller adherence as the proportion of days covered (PDC) from the first controller supply in
+// the past 365 days to today. Source is "dispense" when MedicationDispense resources were found and
+// "request" when supply was estimated from the orders' dispense requests.
+type Adherence struct {
+	PDC         float64
+	Source      string
+	Start       time.Time
+	Days        int
+	CoveredDays int
+}
+
+// Supply of a controller starting on a day
+type supply struct {
+	start time.Time
+	days  int
+}
+
+// Gets the patient's medication dispenses, if the tenant's EHR supports them
+func (er *EligibilityRequest) getMedicationDispenses(wg *sync.WaitGroup, errCh chan<- error, headers map[string]string) {
+	defer wg.Done()
+
+	if er.Config.Adherence == nil || !er.Config.Adherence.Dispenses {
+		errCh <- nil
+		return
+	}
+
+	// Create span
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Medication Dispenses")
+	defer span.End()
+
+	// Initialize query parameters
+	queryParams := url.Values{}
+	queryParams.Add("patient", er.Context.Patient.Id)
+	queryParams.Add("_include", "MedicationDispense:medication")
+
+	// Construct request and add to list
+	requestList := []Request{
+		{
+			Method:      "GET",
+			URL:         er.Host + "/MedicationDispense",
+			QueryParams: queryParams,
+			Body:        nil,
+		},
+	}
+
+	// Send requests and process responses
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
+		errCh <- err
+		return
+	}
+
+	errCh <- nil
+}
+
+// Computes controller adherence from dispenses, falling back to the controller orders. Returns nil
+// if the patient had no controller supply in the past 365 days.
+func (er *EligibilityRequest) adherence() *Adherence {
+	source := "dispense"
+	supplies := er.controllerDispenses()
+	if len(supplies) == 0 {
+		source = "request"
+		supplies = er.controllerSupplies()
+	}
+
+	// Only count supply from the past 365 days
+	today := toDate(clinicalNow())
+	oneYearAgo := today.AddDate(0, 0, -365)
+	supplies = slices.DeleteFunc(supplies, func(s supply) bool {
+		return s.start.Before(oneYearAgo) || s.start.After(today)
+	})
+	if len(supplies) == 0 {
+		return nil
+	}
+
+	// Supply picked up before the previous one runs out starts when it does
+	sort.Slice(supplies, func(i, j int) bool {
+		return supplies[i].start.Before(supplies[j].start)
+	})
+	a := Adherence{
+		Source: source,
+		Start:  supplies[0].start,
+		Days:   daysBetween(supplies[0].start, today) + 1,
+	}
+	var next time.Time
+	for _, s := range supplies {
+		start := maxTime(s.start, next)
+		next = start.AddDate(0, 0, s.days)
+		if next.After(today) {
+			a.CoveredDays += daysBetween(start, today) + 1
+			break
+		}
+		a.CoveredDays += s.days
+	}
+	a.PDC = float64(a.CoveredDays) / float64(a.Days)
+
+	return &a
+}
+
+// Returns the supply of each controller dispense. Dispenses are controllers if they were
+// authorized by a controller order or their medication is a controller.
+func (er *EligibilityRequest) controllerDispenses() []supply {
+	orders := map[string]*MedicationRequest{}
+	for _, mr := range er.Data.ControllerMedicationRequests {
+		orders[mr.Id] = mr
+	}
+
+	var supplies []supply
+	for _, md := range er.Data.MedicationDispenses {
+		if md.Status != "" && md.Status != "completed" {
+			continue
+		}
+
+		var order *MedicationRequest
+		for _, ref := range md.AuthorizingPrescription {
+			if mr, ok := orders[strings.TrimPrefix(ref.Reference, "MedicationRequest/")]; ok {
+				order = mr
+			}
+		}
+		if order == nil && !er.Config.Codes.Controller.MatchString(er.dispenseCode(md)) {
+			continue
+		}
+
+		days := durationDays(md.DaysSupply)
+		if days == 0 && order != nil {
+			days = durationDays(order.DispenseRequest.ExpectedSupplyDuration)
+		}
+		if days == 0 {
+			days = defaultDaysSupply
+		}
+		supplies = append(supplies, supply{start: toDate(md.WhenHandedOver.Time), days: days})
+	}
+	return supplies
+}
+
+// Estimates supply from each controller order's expected supply duration and refills
+func (er *EligibilityRequest) controllerSupplies() []supply {
+	var supplies []supply
+	for _, mr := range er.Data.ControllerMedicationRequests {
+		start := mr.DispenseRequest.ValidityPeriod.Start.Time
+		if start.IsZero() {
+			start = mr.AuthoredOn.Time
+		}
+		days := durationDays(mr.DispenseRequest.ExpectedSupplyDuration)
+		if days == 0 {
+			days = defaultDaysSupply
+		}
+		supplies = append(supplies, supply{start: toDate(start), days: days * (1 + mr.DispenseRequest.NumberOfRepeatsAllowed)})
+	}
+	return supplies
+}
+
+// Returns the GPI code of a dispensed medication
+func (er *EligibilityRequest) dispenseCode(md *MedicationDispense) string {
+	if med, ok := er.Data.Medications[strings.TrimPrefix(md.MedicationReference.Reference, "Medication/")]; ok {
+		return gpiCode(med.Code.Coding)
+	}
+	return gpiCode(md.MedicationCode.Coding)
+}
+
+// Converts a FHIR Duration to whole days. Returns 0 for an unknown unit.
+func durationDays(d Quantity) int {
+	unit := d.Code
+	if unit == "" {
+		unit = d.Unit
+	}
+	switch strings.ToLower(unit) {
+	case "d", "day", "days":
+		return int(d.Value)
+	case "wk", "week", "weeks":
+		return int(d.Value * 7)
+	case "mo", "month", "months":
+		return int(d.Value * 30)
+	}
+	return 0
+}
+
+// Reports whether the patient meets the tenant's minimum adherence. Patients without controller
+// supply, or tenants without a minimum, always meet it.
+func (er *EligibilityRequest) adherent() bool {
+	a := er.Criteria.Adherence
+	if er.Config.Adherence == nil || a == nil {
+		return true
+	}
+	return a.PDC >= er.Config.Adherence.MinPDC
+}
+
+// Summarizes adherence for display
+func (a Adherence) String() string {
+	source := "orders"
+	if a.Source == "dispense" {
+		source = "dispenses"
+	}
+	return fmt.Sprintf("%.0f%% of days covered since %s (%d of %d days, from %s)",
+		a.PDC*100, a.Start.Format("Jan 2, 2006"), a.CoveredDays, a.Days, source)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Actions taken when a patient has a contraindication to SMART
+const (
+	contraindicationSuppress string = "suppress"
+	contraindicationAnnotate string = "annotate"
+)
+
+// Rules used when a tenant does not define its own. Codes are RxNorm ingredients.
+var defaultContraindicationRules = []ContraindicationRule{
+	{Name: "formoterol", Codes: "^25255$", Text: "(?i)formoterol"},
+	{Name: "budesonide", Codes: "^19831$", Text: "(?i)budesonide"},
+	{Name: "mometasone", Codes: "^108118$", Text: "(?i)mometasone"},
+}
+
+type AllergyIntolerance struct {
+	ResourceType       string   `json:"resourcetype"`
+	Id                 string   `json:"id"`
+	ClinicalStatus     Category `json:"clinicalStatus"`
+	VerificationStatus Category `json:"verificationStatus"`
+	Criticality        string   `json:"criticality"`
+	Code               Category `json:"code"`
+	Reaction           []struct {
+		Substance     Category   `json:"substance"`
+		Manifestation []Category `json:"manifestation"`
+	} `json:"reaction"`
+}
+
+// Allergy or intolerance to a SMART medication, matched by a rule
+type Contraindication struct {
+	Rule        string
+	Action      string
+	Allergy     string
+	Criticality string
+}
+
+// Compiles a contraindication rule's patterns and checks its action
+func (r *ContraindicationRule) compile() error {
+	var errs []error
+	if strings.TrimSpace(r.Name) == "" {
+		errs = append(errs, errors.New("name: value is required"))
+	}
+	if r.Codes == "" && r.Text == "" {
+		errs = append(errs, errors.New("codes or text is required"))
+	}
+
+	var err error
+	if r.Codes != "" {
+		if r.codesRe, err = regexp.Compile(r.Codes); err != nil {
+			errs = append(errs, fmt.Errorf("codes: %v", err))
+		}
+	}
+	if r.Text != "" {
+		if r.textRe, err = regexp.Compile(r.Text); err != nil {
+			errs = append(errs, fmt.Errorf("text: %v", err))
+		}
+	}
+
+	switch r.Action {
+	case "":
+		r.Action = contraindicationAnnotate
+	case contraindicationSuppress, contraindicationAnnotate:
+	default:
+		errs = append(errs, fmt.Errorf("action: unknown action %q", r.Action))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reports whether a coded concept matches the rule
+func (r *ContraindicationRule) matches(concept Category) bool {
+	if r.textRe != nil && concept.Text != "" && r.textRe.MatchString(concept.Text) {
+		return true
+	}
+	for _, coding := range concept.Coding {
+		if r.codesRe != nil && r.codesRe.MatchString(coding.Code) {
+			return true
+		}
+		if r.textRe != nil && coding.Display != "" && r.textRe.MatchString(coding.Display) {
+			return true
+		}
+	}
+	return false
+}
+
+func (er *EligibilityRequest) getAllergies(wg *sync.WaitGroup, errCh chan<- error, headers map[string]string) {
+	defer wg.Done()
+
+	// Create span
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Allergies")
+	defer span.End()
+
+	// Initialize query parameters
+	queryParams := url.Values{}
+	queryParams.Add("patient", er.Context.Patient.Id)
+	queryParams.Add("clinical-status", "active")
+
+	// Construct request and add to list
+	requestList := []Request{
+		{
+			Method:      "GET",
+			URL:         er.Host + "/AllergyIntolerance",
+			QueryParams: queryParams,
+			Body:        nil,
+		},
+	}
+
+	// Send requests and process responses
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
+		errCh <- err
+		return
+	}
+
+	errCh <- nil
+}
+
+// Matches the patient's active allergies and intolerances against the tenant's contraindication
+// rules. Allergies that have been refuted or entered in error are ignored.
+func (er *EligibilityRequest) contraindications() []Contraindication {
+	var found []Contraindication
+	rules := er.Config.Contraindications
+
+	for _, allergy := range er.Data.Allergies {
+		if !hasCode(allergy.ClinicalStatus, "", "active") || hasCode(allergy.VerificationStatus, "refuted", "entered-in-error") {
+			continue
+		}
+
+		for i := range rules {
+			rule := &rules[i]
+			matched := rule.matches(allergy.Code)
+			for _, reaction := range allergy.Reaction {
+				matched = matched || rule.matches(reaction.Substance)
+			}
+			if matched {
+				found = append(found, Contraindication{
+					Rule:        rule.Name,
+					Action:      rule.Action,
+					Allergy:     allergyName(allergy),
+					Criticality: allergy.Criticality,
+				})
+			}
+		}
+	}
+
+	return found
+}
+
+// Returns the first contraindication that suppresses the card, if any
+func (er *EligibilityRequest) contraindicated() string {
+	for _, ci := range er.Criteria.Contraindications {
+		if ci.Action == contraindicationSuppress {
+			return "contraindication: " + ci.Rule
+		}
+	}
+	return ""
+}
+
+// Reports whether a status concept has one of the codes. An empty code matches a missing status.
+func hasCode(concept Category, codes ...string) bool {
+	if len(concept.Coding) == 0 {
+		return slices.Contains(codes, "")
+	}
+	return slices.ContainsFunc(concept.Coding, func(coding Coding) bool {
+		return slices.Contains(codes, coding.Code)
+	})
+}
+
+func allergyName(allergy *AllergyIntolerance) string {
+	if allergy.Code.Text != "" {
+		return allergy.Code.Text
+	}
+	for _, coding := range allergy.Code.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+	}
+	return "unknown allergen"
+}
+
+// Warns about annotated contraindications on a card and its suggestions
+func (h *Hook) annotateContraindications(card int, contraindications []Contraindication) {
+	var allergies []string
+	for _, ci := range contraindications {
+		if ci.Action != contraindicationAnnotate {
+			continue
+		}
+		allergy := ci.Allergy
+		if ci.Criticality == "high" {
+			allergy += " (high criticality)"
+		}
+		if !slices.Contains(allergies, allergy) {
+			allergies = append(allergies, allergy)
+		}
+	}
+	if len(allergies) == 0 {
+		return
+	}
+
+	c := &h.Cards[card]
+	c.Indicator = "warning"
+	c.Detail = fmt.Sprintf("<p><strong>Documented allergy or intolerance: %s.</strong> Review before starting SMART.</p>%s",
+		html.EscapeString(strings.Join(allergies, ", ")), c.Detail)
+	for i := range c.Suggestions {
+		c.Suggestions[i].Label += " (review documented allergy)"
+	}
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	appSessionCookie string = "smart_asthma_session"
+	appDefaultScope  string = "launch openid fhirUser patient/*.read"
+
+	// Time allowed between the EHR launch and the authorization callback
+	appLaunchTTL time.Duration = 10 * time.Minute
+)
+
+var (
+	// Public URL of this service, used for the launch link and the redirect URI
+	appBaseURL    string = strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	appSessionTTL int    = getEnvInt("APP_SESSION_TTL", 3600)
+
+	// Launches waiting for the authorization callback, keyed by state
+	appLaunches = newExpiringStore[pendingLaunch]()
+
+	// Authorized app sessions, keyed by session cookie
+	appSessions = newExpiringStore[appSession]()
+
+	//go:embed static/app.html
+	appTemplateHTML string
+	appTemplate     = template.Must(template.New("app").Funcs(templateFuncs).Parse(appTemplateHTML))
+)
+
+// Authorization state kept between the EHR launch and the callback
+type pendingLaunch struct {
+	Tenant        string
+	Issuer        string
+	TokenEndpoint string
+	Verifier      string
+}
+
+// Patient context and access token of a launched app
+type appSession struct {
+	Tenant      string
+	Issuer      string
+	AccessToken string
+	PatientId   string
+	EncounterId string
+}
+
+// Endpoints advertised in .well-known/smart-configuration
+type smartConfiguration struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Patient          string `json:"patient"`
+	Encounter        string `json:"encounter"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Event shown on the app timeline
+type TimelineEvent struct {
+	Start  time.Time
+	End    time.Time
+	Kind   string
+	Label  string
+	Detail string
+	Flag   bool
+}
+
+type criterionRow struct {
+	Name string
+	Met  bool
+}
+
+type appView struct {
+	Patient          Patient
+	Registry         []criterionRow
+	Eligible         []criterionRow
+	Initiated        []criterionRow
+	InRegistry       bool
+	EligibleForSmart bool
+	Control          *ControlAssessment
+	Adherence        *Adherence
+	Timeline         []TimelineEvent
+	Evaluated        time.Time
+}
+
+// Handles the EHR launch, redirecting to the authorization server with a PKCE challenge
+func appLaunch(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	iss := c.QueryParam("iss")
+	launch := c.QueryParam("launch")
+	if iss == "" || launch == "" {
+		return c.String(http.StatusBadRequest, "missing iss or launch parameter")
+	}
+
+	// The issuer of an EHR launch is the FHIR base URL. Only configured FHIR servers are contacted.
+	config, err := currentTenants().resolveLaunch(iss)
+	if err != nil {
+		logger(ctx, err)
+		return c.String(http.StatusForbidden, "unknown FHIR server")
+	}
+	if config.SmartApp == nil {
+		return c.String(http.StatusForbidden, "SMART app is not enabled for this EHR")
+	}
+	ctx = withTenant(ctx, config.Name)
+
+	endpoints, err := getSmartConfiguration(ctx, iss)
+	if err != nil {
+		logger(ctx, err)
+		return c.String(http.StatusBadGateway, "unable to discover SMART endpoints")
+	}
+
+	// Keep the PKCE verifier until the callback
+	verifier := randomToken()
+	state := appLaunches.put(pendingLaunch{
+		Tenant:        config.Name,
+		Issuer:        iss,
+		TokenEndpoint: endpoints.TokenEndpoint,
+		Verifier:      verifier,
+	}, appLaunchTTL)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.SmartApp.ClientId},
+		"redirect_uri":          {appBaseURL + "/app/callback"},
+		"scope":                 {config.SmartApp.scope()},
+		"state":                 {state},
+		"aud":                   {iss},
+		"launch":                {launch},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	return c.Redirect(http.StatusFound, endpoints.AuthorizationEndpoint+"?"+query.Encode())
+}
+
+// Exchanges the authorization code for an access token and starts an app session
+func appCallback(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if e := c.QueryParam("error"); e != "" {
+		logger(ctx, fmt.Errorf("SMART app authorization failed: %s: %s", e, c.QueryParam("error_description")))
+		return c.String(http.StatusUnauthorized, "authorization failed")
+	}
+
+	launch, ok := appLaunches.take(c.QueryParam("state"))
+	if !ok {
+		return c.String(http.StatusBadRequest, "unknown or expired launch, relaunch from the EHR")
+	}
+	config := currentTenants().Tenants[launch.Tenant]
+	if config == nil || config.SmartApp == nil {
+		return c.String(http.StatusForbidden, "SMART app is not enabled for this EHR")
+	}
+	ctx = withTenant(ctx, config.Name)
+
+	token, err := exchangeCode(ctx, launch, config.SmartApp.ClientId, c.QueryParam("code"))
+	if err != nil {
+		authFailures.WithLabelValues("smart_app").Inc()
+		logger(ctx, err)
+		return c.String(http.StatusUnauthorized, "authorization failed")
+	}
+
+	// Sessions end with the access token
+	ttl := time.Duration(appSessionTTL) * time.Second
+	if token.ExpiresIn > 0 && time.Duration(token.ExpiresIn)*time.Second < ttl {
+		ttl = time.Duration(token.ExpiresIn) * time.Second
+	}
+	id := appSessions.put(appSession{
+		Tenant:      config.Name,
+		Issuer:      launch.Issuer,
+		AccessToken: token.AccessToken,
+		PatientId:   token.Patient,
+		EncounterId: token.Encounter,
+	}, ttl)
+
+	// The app is embedded in the EHR, so the cookie must be sent in a third-party context
+	c.SetCookie(&http.Cookie{
+		Name:     appSessionCookie,
+		Value:    id,
+		Path:     "/app",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+
+	return c.Redirect(http.StatusFound, appBaseURL+"/app")
+}
+
+// Re-runs the evaluation for the launched patient and renders the explanation page
+func appPage(c echo.Context) error {
+	er, err := appEvaluate(c)
+	if err != nil {
+		return err
+	}
+	er.sendWebLog("app: eligibility explanation viewed")
+
+	view := appView{
+		Patient:          er.Context.Patient,
+		Registry:         criteriaRows(er.Criteria.AsthmaRegistry),
+		InRegistry:       er.Criteria.AsthmaRegistry.Evaluation,
+		EligibleForSmart: er.eligibleForSmart(),
+		Control:          er.Criteria.Control,
+		Adherence:        er.Criteria.Adherence,
+		Timeline:         er.timeline(),
+		Evaluated:        time.Now(),
+	}
+	if er.Criteria.SmartEligible != nil {
+		view.Eligible = criteriaRows(er.Criteria.SmartEligible)
+		view.Initiated = criteriaRows(er.Criteria.SmartInitiated)
+	}
+
+	var buf strings.Builder
+	if err := appTemplate.Execute(&buf, view); err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.HTML(http.StatusOK, buf.String())
+}
+
+// Returns a draft SMART action plan for the launched patient
+func appActionPlan(c echo.Context) error {
+	er, err := appEvaluate(c)
+	if err != nil {
+		return err
+	}
+	er.sendWebLog("app: action plan generated")
+	return er.renderActionPlan(c)
+}
+
+// Evaluates the patient of the app session the same way as the eligibility hook. The returned
+// error is the response sent when the evaluation fails.
+func appEvaluate(c echo.Context) (*EligibilityRequest, error) {
+	cookie, err := c.Cookie(appSessionCookie)
+	if err != nil {
+		return nil, c.String(http.StatusUnauthorized, "session expired, relaunch from the EHR")
+	}
+	session, ok := appSessions.get(cookie.Value)
+	if !ok {
+		return nil, c.String(http.StatusUnauthorized, "session expired, relaunch from the EHR")
+	}
+
+	var hookRequest HookRequest
+	hookRequest.FHIRServer = session.Issuer
+	hookRequest.FHIRAuthorization.AccessToken = session.AccessToken
+	hookRequest.Context.PatientId = session.PatientId
+	hookRequest.Context.EncounterId = session.EncounterId
+
+	er, err := newEligibilityRequest(c, hookRequest)
+	if err != nil {
+		logger(c.Request().Context(), err)
+		return nil, c.String(http.StatusForbidden, "unknown FHIR server")
+	}
+	if err := er.getData(er.Headers); err != nil {
+		return nil, c.String(http.StatusBadGateway, "unable to retrieve patient data")
+	}
+	er.evaluate()
+
+	return er, nil
+}
+
+// Builds the timeline of steroid courses, controller courses, Asthma Control Tool responses and
+// asthma action plan zones, most recent first
+func (er *EligibilityRequest) timeline() []TimelineEvent {
+	var events []TimelineEvent
+
+	// Courses are sorted most recent first, as are the orders within them
+	courses := func(kind, label string, groups [][]*MedicationRequest) {
+		for _, course := range groups {
+			var names []string
+			for _, mr := range course {
+				if name := medicationName(mr); !slices.Contains(names, name) {
+					names = append(names, name)
+				}
+			}
+			events = append(events, TimelineEvent{
+				Start:  course[len(course)-1].AuthoredOn.Time,
+				End:    course[0].AuthoredOn.Time,
+				Kind:   kind,
+				Label:  label,
+				Detail: fmt.Sprintf("%s (%d orders)", strings.Join(names, ", "), len(course)),
+			})
+		}
+	}
+	courses("scs", "Systemic steroid course", er.Data.SteroidCourses)
+	courses("controller", "Controller course", er.Data.ControllerCourses)
+
+	// SCS-only exacerbations are shown as steroid courses
+	for _, e := range er.Data.Exacerbations {
+		if e.Setting == settingOutpatient {
+			continue
+		}
+		events = append(events, TimelineEvent{
+			Start:  e.Start,
+			End:    e.End,
+			Kind:   "exacerbation",
+			Label:  "Asthma exacerbation",
+			Detail: fmt.Sprintf("%s, %s (%d %s)", e.Severity, e.Setting, len(e.Encounters), plural(len(e.Encounters), "encounter", "encounters")),
+			Flag:   e.Severity == "severe",
+		})
+	}
+
+	for _, o := range er.Data.AsthmaControlTool.Observations {
+		tool, value, control := er.Config.controlToolResult(o)
+		uncontrolled := control == controlNotWell || control == controlVeryPoorly
+		detail := "Controlled"
+		if uncontrolled {
+			detail = "Uncontrolled"
+		}
+		if tool != "status" {
+			detail = fmt.Sprintf("%s %d, %s", tool, value, control)
+		}
+		events = append(events, TimelineEvent{
+			Start:  o.Issued.Time,
+			Kind:   "act",
+			Label:  "Asthma Control Tool",
+			Detail: detail,
+			Flag:   uncontrolled,
+		})
+	}
+
+	zones := func(label string, observations []*Observation) {
+		for _, o := range observations {
+			var medications []string
+			for _, component := range o.Component {
+				if text := component.ValueCodeableConcept.Text; text != "" {
+					medications = append(medications, text)
+					continue
+				}
+				for _, coding := range component.ValueCodeableConcept.Coding {
+					medications = append(medications, coding.Display)
+				}
+			}
+			events = append(events, TimelineEvent{
+				Start:  o.Issued.Time,
+				Kind:   "aap",
+				Label:  label,
+				Detail: strings.Join(medications, ", "),
+			})
+		}
+	}
+	zones("Action plan green zone", er.Data.AsthmaActionPlan.GreenZone)
+	zones("Action plan yellow zone", er.Data.AsthmaActionPlan.YellowZone)
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.After(events[j].Start)
+	})
+
+	return events
+}
+
+// Lists the boolean criteria in a criteria struct
+func criteriaRows(criteria any) []criterionRow {
+	val := reflect.Indirect(reflect.ValueOf(criteria))
+	typ := val.Type()
+
+	var rows []criterionRow
+	for i := range val.NumField() {
+		if val.Field(i).Kind() != reflect.Bool || typ.Field(i).Name == "Evaluation" {
+			continue
+		}
+		rows = append(rows, criterionRow{Name: typ.Field(i).Name, Met: val.Field(i).Bool()})
+	}
+	return rows
+}
+
+// Adds a link to a card that launches the SMART app
+func (h *Hook) addAppLink(card int, config *Config) {
+	if config.SmartApp == nil || appBaseURL == "" {
+		return
+	}
+	h.Cards[card].Links = append(h.Cards[card].Links, Link{
+		Label: "Why is this patient eligible?",
+		URL:   appBaseURL + "/app/launch",
+		Type:  "smart",
+	})
+}
+
+// Returns the scopes requested by the app
+func (a *SmartAppConfig) scope() string {
+	if a.Scope == "" {
+		return appDefaultScope
+	}
+	return a.Scope
+}
+
+// Discovers the authorization and token endpoints of a FHIR server
+func getSmartConfiguration(ctx context.Context, iss string) (*smartConfiguration, error) {
+	resp, err := sendRequest(ctx, "GET", strings.TrimRight(iss, "/")+"/.well-known/smart-configuration", nil, map[string]string{"Accept": "application/json"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("smart-configuration returned %d: %s", resp.StatusCode, body)
+	}
+
+	var config smartConfiguration
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("error unmarshalling smart-configuration: %v", err)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" {
+		return nil, errors.New("smart-configuration is missing the authorization or token endpoint")
+	}
+	return &config, nil
+}
+
+// Exchanges an authorization code using the PKCE verifier of the launch
+func exchangeCode(ctx context.Context, launch pendingLaunch, clientId, code string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {appBaseURL + "/app/callback"},
+		"client_id":     {clientId},
+		"code_verifier": {launch.Verifier},
+	}
+	headers := map[string]string{
+		"Accept":       "application/json",
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+
+	resp, err := sendRequest(ctx, "POST", launch.TokenEndpoint, nil, headers, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("error unmarshalling token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token request returned %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" || token.Patient == "" {
+		return nil, errors.New("token response is missing the access token or patient context")
+	}
+	return &token, nil
+}
+
+// Returns a random URL-safe token
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// In-memory values that expire after a time to live
+type expiringStore[T any] struct {
+	mu    sync.Mutex
+	items map[string]expiringItem[T]
+}
+
+type expiringItem[T any] struct {
+	value   T
+	expires time.Time
+}
+
+func newExpiringStore[T any]() *expiringStore[T] {
+	return &expiringStore[T]{items: map[string]expiringItem[T]{}}
+}
+
+// Stores a value under a new random key
+func (s *expiringStore[T]) put(value T, ttl time.Duration) string {
+	key := randomToken()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Remove expired values
+	for k, item := range s.items {
+		if now.After(item.expires) {
+			delete(s.items, k)
+		}
+	}
+	s.items[key] = expiringItem[T]{value: value, expires: now.Add(ttl)}
+	return key
+}
+
+func (s *expiringStore[T]) get(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok || time.Now().After(item.expires) {
+		var zero T
+		return zero, false
+	}
+	return item.value, true
+}
+
+// Returns and removes a value so it can only be used once
+func (s *expiringStore[T]) take(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	delete(s.items, key)
+	if !ok || time.Now().After(item.expires) {
+		var zero T
+		return zero, false
+	}
+	return item.value, true
+}
@@ -2,15 +2,7 @@ package main
 
 import (
 	"net/url"
-	"os"
-	"regexp"
 	"sync"
-
-	"go.elastic.co/apm"
-)
-
-var (
-	csnSystemRegex = regexp.MustCompile(os.Getenv("CSN_SYSTEM_REGEX"))
 )
 
 type Appointment struct {
@@ -27,7 +19,7 @@ func (er *EligibilityRequest) getAppointments(wg *sync.WaitGroup, errCh chan<- e
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Appointments")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Appointments")
 	defer span.End()
 
 	// Initialize query parameters
@@ -38,7 +30,7 @@ func (er *EligibilityRequest) getAppointments(wg *sync.WaitGroup, errCh chan<- e
 	requestList := splitRequest(er.Host+"/Appointment", 2, 730, queryParams, headers)
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -67,7 +59,7 @@ func (er *EligibilityRequest) processAppointments() {
 	// Loop through appointments to build a map and remove appointments older than yesterday
 	for _, appointment := range data.Appointments {
 		for _, identifier := range appointment.Identifier {
-			if csnSystemRegex.MatchString(identifier.System) {
+			if er.Config.Codes.CSNSystem.MatchString(identifier.System) {
 				er.Maps.CSNStatus[identifier.Value] = appointment.Status
 			}
 		}
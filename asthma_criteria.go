@@ -1,19 +1,13 @@
 package main
 
 import (
-	"os"
-	"regexp"
+	"fmt"
 	"strings"
-	"time"
-)
-
-var (
-	asthmaICDRegex           = regexp.MustCompile(os.Getenv("ASTHMA_ICD_REGEX"))
-	encounterTypeSystemRegex = regexp.MustCompile(os.Getenv("ENC_TYPE_SYSTEM_REGEX"))
 )
 
 type AsthmaRegistryCriteria struct {
 	Alive            bool
+	TestPatient      bool
 	Encounter        bool
 	Asthma           bool
 	PersistentAsthma bool
@@ -22,6 +16,12 @@ type AsthmaRegistryCriteria struct {
 	Evaluation       bool
 }
 
+// Summarizes the criteria for the evaluation log
+func (arc AsthmaRegistryCriteria) String() string {
+	return fmt.Sprintf("Evaluation:%t,Alive:%t,Encounter:%t,Asthma:%t,AsthmaEncDx:%t,AsthmaMed:%t,PersistentAsthma:%t,TestPatient:%t",
+		arc.Evaluation, arc.Alive, arc.Encounter, arc.Asthma, arc.AsthmaEncDx, arc.AsthmaMed, arc.PersistentAsthma, arc.TestPatient)
+}
+
 func (er *EligibilityRequest) asthmaRegistry() *AsthmaRegistryCriteria {
 	/*
 	 * Patient is alive
@@ -40,14 +40,17 @@ func (er *EligibilityRequest) asthmaRegistry() *AsthmaRegistryCriteria {
 	 */
 
 	// Set date values
-	today := time.Now()
+	today := clinicalNow()
 	yesterday := today.AddDate(0, 0, -1)
 
 	// Evaluate asthma registry criteria
 	arc := AsthmaRegistryCriteria{}
 
 	// Check if patient is alive
-	arc.Alive = (er.Context.Patient.DeceasedDateTime == "")
+	arc.Alive = !er.Context.Patient.Deceased.IsDeceased()
+
+	// Check if patient is a test patient
+	arc.TestPatient = er.isTestPatient()
 
 	// Filter out hospital problems older than one year ago
 	filteredHospitalProblems := er.filterHospitalProblemsByTime(er.Data.HospitalProblems, -365)
@@ -58,7 +61,7 @@ EncounterLoop:
 		if encounter.Status != "cancelled" && encounter.Status != "noshow" {
 			for _, coding := range encounter.Type {
 				for _, code := range coding.Coding {
-					if encounterTypeSystemRegex.MatchString(code.System) {
+					if er.Config.Codes.EncounterTypeSystem.MatchString(code.System) {
 						if code.Code == "3" || code.Code == "101" || code.Code == "153" {
 							arc.Encounter = true
 							break EncounterLoop
@@ -88,7 +91,7 @@ AsthmaLoop:
 	for _, problem := range er.Data.ProblemList {
 		for _, code := range problem.Code.Coding {
 			if code.System == "http://hl7.org/fhir/sid/icd-10-cm" {
-				if asthmaICDRegex.MatchString(code.Code) {
+				if er.Config.Codes.AsthmaICD.MatchString(code.Code) {
 					arc.Asthma = true
 					if strings.Contains(strings.ToLower(code.Display), "persistent") {
 						arc.PersistentAsthma = true
@@ -108,7 +111,7 @@ AsthmaLoop:
 EncDxLoop:
 	for _, dx := range append(er.Data.EncDiagnosis, filteredHospitalProblems...) {
 		for _, code := range dx.Code.Coding {
-			if asthmaICDRegex.MatchString(code.Code) {
+			if er.Config.Codes.AsthmaICD.MatchString(code.Code) {
 				arc.AsthmaEncDx = true
 				break EncDxLoop
 			}
@@ -116,7 +119,7 @@ EncDxLoop:
 	}
 
 	// Return final evaluation
-	arc.Evaluation = arc.Alive && arc.Encounter && (((arc.Asthma || arc.AsthmaEncDx) && arc.AsthmaMed) || arc.PersistentAsthma)
+	arc.Evaluation = arc.Alive && !arc.TestPatient && arc.Encounter && (((arc.Asthma || arc.AsthmaEncDx) && arc.AsthmaMed) || arc.PersistentAsthma)
 
 	return &arc
 }
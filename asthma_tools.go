@@ -5,9 +5,6 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"time"
-
-	"go.elastic.co/apm"
 )
 
 type Observation struct {
@@ -18,7 +15,8 @@ type Observation struct {
 	Code         struct {
 		Coding []Coding `json:"coding"`
 	} `json:"code"`
-	Focus []ResourceReference
+	Focus     []ResourceReference
+	Effective Effective `json:"-"`
 }
 
 type Component struct {
@@ -36,20 +34,20 @@ func (er *EligibilityRequest) getAsthmaActionPlan(wg *sync.WaitGroup, errCh chan
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Asthma Action Plan")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Asthma Action Plan")
 	defer span.End()
 
 	// Set values to look for
 	// TODO - Need to change to AAP values (patient based)
 	values := []string{
-		config.AsthmaActionPlan.GreenZone,
-		config.AsthmaActionPlan.YellowZone,
+		er.Config.AsthmaActionPlan.GreenZone,
+		er.Config.AsthmaActionPlan.YellowZone,
 	}
 
 	// Pre-pend OID to each value
 	modified := []string{}
 	for _, id := range values {
-		modified = append(modified, config.ObservationOID+"|"+id)
+		modified = append(modified, er.Config.ObservationOID+"|"+id)
 	}
 
 	// Initialize query parameters
@@ -69,7 +67,7 @@ func (er *EligibilityRequest) getAsthmaActionPlan(wg *sync.WaitGroup, errCh chan
 	}
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -81,17 +79,17 @@ func (er *EligibilityRequest) getAsthmaControlTool(wg *sync.WaitGroup, errCh cha
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Asthma Control Tool")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Asthma Control Tool")
 	defer span.End()
 
 	// Create lookback period
-	sixMonthLookback := time.Now().AddDate(0, 0, -183)
+	sixMonthLookback := clinicalNow().AddDate(0, 0, -183)
 	dateFormat := "2006-01-02"
 
 	// Pre-pend OID to each value
 	modified := []string{}
-	for id, _ := range config.AsthmaControlTool {
-		modified = append(modified, config.ObservationOID+"|"+id)
+	for id := range er.Config.AsthmaControlTool {
+		modified = append(modified, er.Config.ObservationOID+"|"+id)
 	}
 
 	// Initialize query parameters
@@ -112,7 +110,7 @@ func (er *EligibilityRequest) getAsthmaControlTool(wg *sync.WaitGroup, errCh cha
 	}
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -137,25 +135,35 @@ func (er *EligibilityRequest) evaluateACT() {
 
 	// Initialize encounter Id to match values to
 	var encounterId string
+	act := &er.Data.AsthmaControlTool
 
 	// Iterate over questionnaire responses to filter out those that aren't relevant
-	for _, o := range er.Data.AsthmaControlTool.Observations {
+	for _, o := range act.Observations {
+		if len(o.Focus) == 0 {
+			continue
+		}
+
 		// Set encounterId, if not set
 		if encounterId == "" {
 			encounterId = o.Focus[0].Reference
 		}
 
 		// Store the time for when the ACT used for analysis was completed
-		er.Data.AsthmaControlTool.Date = o.Issued.Time
+		act.Date = o.Issued.Time
 
 		// Check if the focus is for the same encounter. Only pull the latest encounter
 		// as determined by the latest encounter where a value was changed.
 		if o.Focus[0].Reference == encounterId {
-			for _, component := range o.Component {
-				if component.ValueQuantity.Value > er.Data.AsthmaControlTool.Status {
-					er.Data.AsthmaControlTool.Status = component.ValueQuantity.Value
+			// Scores are read as the matching status, keeping the latest score
+			tool, value, control := er.Config.controlToolResult(o)
+			status := value
+			if tool != "status" {
+				status = controlStatus(control)
+				if act.Tool == "" {
+					act.Tool, act.Score = tool, value
 				}
 			}
+			act.Status = max(act.Status, status)
 		}
 	}
 }
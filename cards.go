@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const defaultLanguage string = "en"
+
+var (
+	// Directory of template overrides, laid out as <tenant>/<language>/*.html. A "default" tenant
+	// directory applies to every tenant.
+	templateDir string = getEnv("TEMPLATE_DIR", "templates")
+
+	//go:embed templates
+	builtinTemplates embed.FS
+
+	// Functions available to card and app templates
+	templateFuncs = template.FuncMap{
+		"date": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format("Jan 2, 2006")
+		},
+	}
+)
+
+// Data available to card templates
+type CardData struct {
+	Tenant          string
+	CriteriaVersion string
+	Language        string
+	Patient         Patient
+	Criteria        Criteria
+	Evidence        *Data
+	Timeline        []TimelineEvent
+	Dosing          *DosingRecommendation
+}
+
+// Returns the language of the tenant's cards
+func (c *Config) language() string {
+	if c.Language == "" {
+		return defaultLanguage
+	}
+	return c.Language
+}
+
+// Parses the card templates for a tenant. Each layer overrides the templates defined by the ones
+// before it, so a tenant only needs to define the templates it changes.
+func (c *Config) loadTemplates() (*template.Template, error) {
+	lang := c.language()
+	disk := os.DirFS(templateDir)
+
+	// The built-in templates are English and the base of every language
+	layers := []struct {
+		fsys fs.FS
+		dir  string
+	}{
+		{builtinTemplates, "templates/default/" + defaultLanguage},
+		{disk, "default/" + lang},
+		{disk, c.Name + "/" + lang},
+	}
+
+	tmpl := template.New("card").Funcs(templateFuncs)
+	var found bool
+	for i, layer := range layers {
+		matches, err := fs.Glob(layer.fsys, path.Join(layer.dir, "*.html"))
+		if err != nil || len(matches) == 0 {
+			continue
+		}
+		if tmpl, err = tmpl.ParseFS(layer.fsys, matches...); err != nil {
+			return nil, fmt.Errorf("templates: %v", err)
+		}
+		if i > 0 {
+			found = true
+		}
+	}
+
+	if !found && lang != defaultLanguage {
+		return nil, fmt.Errorf("language: no templates found for %q", lang)
+	}
+
+	// Templates must render against a sample patient
+	if _, _, err := renderCard(tmpl, sampleCardData(c)); err != nil {
+		return nil, fmt.Errorf("templates: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+// Renders the card summary and detail for the request
+func (er *EligibilityRequest) renderCard() (string, string, error) {
+	return renderCard(er.Config.Templates, CardData{
+		Tenant:          er.Config.Name,
+		CriteriaVersion: er.Config.CriteriaVersion,
+		Language:        er.Config.language(),
+		Patient:         er.Context.Patient,
+		Criteria:        er.Criteria,
+		Evidence:        er.Data,
+		Timeline:        er.timeline(),
+		Dosing:          er.recommendDose(),
+	})
+}
+
+func renderCard(tmpl *template.Template, data CardData) (string, string, error) {
+	var summary, detail bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&summary, "summary", data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&detail, "detail", data); err != nil {
+		return "", "", err
+	}
+
+	// The summary is plain text, so undo HTML escaping
+	s := strings.TrimSpace(html.UnescapeString(summary.String()))
+	if s == "" {
+		return "", "", errors.New("summary is empty")
+	}
+
+	return s, strings.TrimSpace(detail.String()), nil
+}
+
+// Builds a patient meeting every criterion, used to check templates render
+func sampleCardData(c *Config) CardData {
+	now := time.Now()
+	course := []*MedicationRequest{{Id: "sample", AuthoredOn: Date{Time: now.AddDate(0, -1, 0)}}}
+
+	return CardData{
+		Tenant:          c.Name,
+		CriteriaVersion: c.CriteriaVersion,
+		Language:        c.language(),
+		Patient: Patient{
+			Id:        "sample",
+			MRN:       "00000000",
+			BirthDate: Date{Time: now.AddDate(-10, 0, 0)},
+		},
+		Criteria: Criteria{
+			AsthmaRegistry: &AsthmaRegistryCriteria{
+				Alive:            true,
+				Encounter:        true,
+				Asthma:           true,
+				PersistentAsthma: true,
+				AsthmaMed:        true,
+				AsthmaEncDx:      true,
+				Evaluation:       true,
+			},
+			SmartEligible: &SmartEligibleCriteria{
+				Age:               true,
+				PrimaryCare:       true,
+				Controller365Days: true,
+				SCS183:            true,
+				SCSEpisode365:     true,
+				SCSDates:          []time.Time{now.AddDate(0, -1, 0), now.AddDate(0, -5, 0)},
+				UncontrolledACT:   true,
+				Adherent:          true,
+				Evaluation:        true,
+			},
+			SmartInitiated: &SmartInitiatedCriteria{},
+			Adherence: &Adherence{
+				PDC:         0.5,
+				Source:      "request",
+				Start:       now.AddDate(0, -6, 0),
+				Days:        183,
+				CoveredDays: 92,
+			},
+			Control: &ControlAssessment{
+				Step:            2,
+				StepBasis:       "ICS (fluticasone).",
+				Tool:            "C-ACT",
+				Score:           15,
+				Impairment:      controlNotWell,
+				SCSCourses:      2,
+				Exacerbations:   2,
+				HighRisk:        true,
+				Control:         controlNotWell,
+				Severity:        "moderate persistent",
+				RecommendedStep: 3,
+			},
+		},
+		Evidence: &Data{
+			Medications:    map[string]*Medication{},
+			SteroidCourses: [][]*MedicationRequest{course},
+			Exacerbations: []Exacerbation{
+				{Start: now.AddDate(0, -1, 0), End: now.AddDate(0, -1, 0), Setting: settingEmergency, Severity: "severe", Steroids: course},
+			},
+			ControllerCourses: [][]*MedicationRequest{course},
+			AsthmaControlTool: AsthmaControlTool{Status: 2, Date: now.AddDate(0, -1, 0)},
+		},
+		Timeline: []TimelineEvent{
+			{Start: now.AddDate(0, -1, 0), Kind: "scs", Label: "Systemic steroid course", Detail: "prednisoLONE (1 orders)"},
+			{Start: now.AddDate(0, -1, 0), Kind: "act", Label: "Asthma Control Tool", Detail: "Uncontrolled", Flag: true},
+		},
+		Dosing: &DosingRecommendation{
+			Product: FormularyProduct{
+				Medication: Coding{Code: "sample", Display: "budesonide-formoterol 80-4.5 mcg/actuation"},
+			},
+			Step:             3,
+			MaintenancePuffs: 1,
+			RelieverPuffs:    1,
+			MaxDailyPuffs:    8,
+			Basis:            "Current treatment is step 2. ICS (fluticasone).",
+		},
+	}
+}
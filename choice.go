@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Decodes a FHIR choice type element (name[x]) into the target for its type. Targets map a type
+// suffix, such as "Boolean" or "DateTime", to a pointer to decode into. An element with more than
+// one type, or a type without a target, is an error. A missing element leaves the targets unset.
+func decodeChoice(data []byte, name string, targets map[string]any) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var found string
+	for key, value := range fields {
+		suffix, ok := strings.CutPrefix(key, name)
+		if !ok || suffix == "" || !unicode.IsUpper(rune(suffix[0])) {
+			continue
+		}
+		if found != "" {
+			return fmt.Errorf("%s[x]: both %s and %s are set", name, name+found, key)
+		}
+		found = suffix
+
+		target, ok := targets[suffix]
+		if !ok {
+			return fmt.Errorf("%s[x]: unsupported type %s", name, suffix)
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Patient.deceased[x]
+type Deceased struct {
+	Boolean  *bool
+	DateTime Date
+}
+
+// Reports whether the patient has died, by either form of deceased[x]
+func (d Deceased) IsDeceased() bool {
+	return (d.Boolean != nil && *d.Boolean) || !d.DateTime.IsZero()
+}
+
+func (p *Patient) UnmarshalJSON(data []byte) error {
+	type patient Patient
+	if err := json.Unmarshal(data, (*patient)(p)); err != nil {
+		return err
+	}
+
+	p.Deceased = Deceased{}
+	if err := decodeChoice(data, "deceased", map[string]any{
+		"Boolean":  &p.Deceased.Boolean,
+		"DateTime": &p.Deceased.DateTime,
+	}); err != nil {
+		return err
+	}
+
+	// A date of death in the future is most likely clock skew between the EHR and this server. The
+	// patient is still treated as deceased.
+	if p.Deceased.DateTime.After(clinicalNow()) {
+		zapLogger.Warn(fmt.Sprintf("deceasedDateTime %s is in the future (patient: %s)", p.Deceased.DateTime.Format(time.RFC3339), p.Id))
+	}
+	return nil
+}
+
+// Dosage.asNeeded[x]. A reason implies the dose is as needed.
+func (d *DosageInstruction) UnmarshalJSON(data []byte) error {
+	type dosageInstruction DosageInstruction
+	if err := json.Unmarshal(data, (*dosageInstruction)(d)); err != nil {
+		return err
+	}
+
+	d.AsNeeded, d.AsNeededFor = false, nil
+	if err := decodeChoice(data, "asNeeded", map[string]any{
+		"Boolean":         &d.AsNeeded,
+		"CodeableConcept": &d.AsNeededFor,
+	}); err != nil {
+		return err
+	}
+	if d.AsNeededFor != nil {
+		d.AsNeeded = true
+	}
+	return nil
+}
+
+// Condition.onset[x]
+type Onset struct {
+	DateTime Date
+	Age      *Quantity
+	Period   *Period
+	Range    *struct {
+		Low  *Quantity `json:"low"`
+		High *Quantity `json:"high"`
+	}
+	String string
+}
+
+// Returns when the condition began, from a date, period or age at onset. Other forms of onset
+// return the zero time.
+func (o Onset) Time(birthDate time.Time) time.Time {
+	switch {
+	case !o.DateTime.IsZero():
+		return o.DateTime.Time
+	case o.Period != nil:
+		return o.Period.Start.Time
+	case o.Age != nil:
+		unit := o.Age.Code
+		if unit == "" {
+			unit = o.Age.Unit
+		}
+		n := int(o.Age.Value)
+		switch strings.ToLower(unit) {
+		case "a", "year", "years":
+			return birthDate.AddDate(n, 0, 0)
+		case "mo", "month", "months":
+			return birthDate.AddDate(0, n, 0)
+		case "wk", "week", "weeks":
+			return birthDate.AddDate(0, 0, 7*n)
+		case "d", "day", "days":
+			return birthDate.AddDate(0, 0, n)
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	type condition Condition
+	if err := json.Unmarshal(data, (*condition)(c)); err != nil {
+		return err
+	}
+
+	c.Onset = Onset{}
+	return decodeChoice(data, "onset", map[string]any{
+		"DateTime": &c.Onset.DateTime,
+		"Age":      &c.Onset.Age,
+		"Period":   &c.Onset.Period,
+		"Range":    &c.Onset.Range,
+		"String":   &c.Onset.String,
+	})
+}
+
+// Observation.effective[x]
+type Effective struct {
+	DateTime Date
+	Instant  Date
+	Period   *Period
+	Timing   json.RawMessage
+}
+
+// Returns when the observation was made, if recorded as a date
+func (e Effective) Time() time.Time {
+	switch {
+	case !e.DateTime.IsZero():
+		return e.DateTime.Time
+	case !e.Instant.IsZero():
+		return e.Instant.Time
+	case e.Period != nil:
+		return e.Period.Start.Time
+	}
+	return time.Time{}
+}
+
+func (o *Observation) UnmarshalJSON(data []byte) error {
+	type observation Observation
+	if err := json.Unmarshal(data, (*observation)(o)); err != nil {
+		return err
+	}
+
+	o.Effective = Effective{}
+	return decodeChoice(data, "effective", map[string]any{
+		"DateTime": &o.Effective.DateTime,
+		"Instant":  &o.Effective.Instant,
+		"Period":   &o.Effective.Period,
+		"Timing":   &o.Effective.Timing,
+	})
+}
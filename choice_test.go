@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Builds an eligibility request for a patient with the default value sets
+func testRequest(t *testing.T, patient Patient) *EligibilityRequest {
+	t.Helper()
+	codes, err := ValueSetConfig{}.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &EligibilityRequest{
+		Config: &Config{Name: "test", Codes: codes},
+		Data:   &Data{Medications: map[string]*Medication{}},
+		Maps: &Maps{
+			MedicationType: map[string]map[string]int{"antiasthmatic": {}},
+			FullURL:        map[string]string{},
+		},
+		Context: CDSContext{RequestContext: context.Background(), Patient: patient},
+	}
+}
+
+func TestDecodeChoice(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		boolean *bool
+		text    string
+		err     string
+	}{
+		{name: "boolean", data: `{"valueBoolean": true}`, boolean: new(bool)},
+		{name: "string", data: `{"valueString": "yes"}`, text: "yes"},
+		{name: "missing", data: `{"other": 1}`},
+		{name: "prefix only", data: `{"value": true}`},
+		{name: "lowercase suffix", data: `{"valueset": "x"}`},
+		{name: "conflicting types", data: `{"valueBoolean": true, "valueString": "yes"}`, err: "are set"},
+		{name: "unsupported type", data: `{"valueInteger": 1}`, err: "unsupported type Integer"},
+		{name: "wrong type", data: `{"valueBoolean": "yes"}`, err: "valueBoolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var boolean *bool
+			var text string
+			err := decodeChoice([]byte(tt.data), "value", map[string]any{
+				"Boolean": &boolean,
+				"String":  &text,
+			})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (boolean == nil) != (tt.boolean == nil) {
+				t.Errorf("boolean = %v, want set %t", boolean, tt.boolean != nil)
+			}
+			if text != tt.text {
+				t.Errorf("string = %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
+
+func TestPatientDeceased(t *testing.T) {
+	future := clinicalNow().AddDate(0, 0, 1).Format("2006-01-02")
+	tests := []struct {
+		name     string
+		data     string
+		deceased bool
+		err      bool
+	}{
+		{name: "not set", data: `{"id": "p"}`},
+		{name: "boolean true", data: `{"id": "p", "deceasedBoolean": true}`, deceased: true},
+		{name: "boolean false", data: `{"id": "p", "deceasedBoolean": false}`},
+		{name: "dateTime", data: `{"id": "p", "deceasedDateTime": "2020-05-01T10:00:00-04:00"}`, deceased: true},
+		{name: "date", data: `{"id": "p", "deceasedDateTime": "2020-05-01"}`, deceased: true},
+		{name: "future dateTime", data: `{"id": "p", "deceasedDateTime": "` + future + `"}`, deceased: true},
+		{name: "conflicting types", data: `{"id": "p", "deceasedBoolean": true, "deceasedDateTime": "2020-05-01"}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Patient
+			err := json.Unmarshal([]byte(tt.data), &p)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Deceased.IsDeceased(); got != tt.deceased {
+				t.Errorf("IsDeceased() = %t, want %t", got, tt.deceased)
+			}
+
+			// Deceased patients are not in the asthma registry
+			arc := testRequest(t, p).asthmaRegistry()
+			if arc.Alive == tt.deceased {
+				t.Errorf("Alive = %t, want %t", arc.Alive, !tt.deceased)
+			}
+			if tt.deceased && arc.Evaluation {
+				t.Error("deceased patient is in the asthma registry")
+			}
+		})
+	}
+}
+
+func TestDosageAsNeeded(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		asNeeded bool
+		reason   string
+		err      bool
+	}{
+		{name: "not set", data: `{}`},
+		{name: "boolean true", data: `{"asNeededBoolean": true}`, asNeeded: true},
+		{name: "boolean false", data: `{"asNeededBoolean": false}`},
+		{name: "codeable concept", data: `{"asNeededCodeableConcept": {"text": "wheezing"}}`, asNeeded: true, reason: "wheezing"},
+		{name: "conflicting types", data: `{"asNeededBoolean": false, "asNeededCodeableConcept": {"text": "wheezing"}}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d DosageInstruction
+			err := json.Unmarshal([]byte(tt.data), &d)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.AsNeeded != tt.asNeeded {
+				t.Errorf("AsNeeded = %t, want %t", d.AsNeeded, tt.asNeeded)
+			}
+			var reason string
+			if d.AsNeededFor != nil {
+				reason = d.AsNeededFor.Text
+			}
+			if reason != tt.reason {
+				t.Errorf("AsNeededFor = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestConditionOnset(t *testing.T) {
+	birthDate := time.Date(2015, 3, 10, 0, 0, 0, 0, clinicalLocation)
+	tests := []struct {
+		name string
+		data string
+		want time.Time
+		err  bool
+	}{
+		{name: "not set", data: `{}`},
+		{name: "dateTime", data: `{"onsetDateTime": "2020-06-15"}`, want: time.Date(2020, 6, 15, 0, 0, 0, 0, clinicalLocation)},
+		{name: "period", data: `{"onsetPeriod": {"start": "2019-01-02"}}`, want: time.Date(2019, 1, 2, 0, 0, 0, 0, clinicalLocation)},
+		{name: "age in years", data: `{"onsetAge": {"value": 4, "code": "a"}}`, want: birthDate.AddDate(4, 0, 0)},
+		{name: "age in months", data: `{"onsetAge": {"value": 18, "unit": "months"}}`, want: birthDate.AddDate(0, 18, 0)},
+		{name: "age in weeks", data: `{"onsetAge": {"value": 3, "code": "wk"}}`, want: birthDate.AddDate(0, 0, 21)},
+		{name: "age in days", data: `{"onsetAge": {"value": 10, "code": "d"}}`, want: birthDate.AddDate(0, 0, 10)},
+		{name: "range", data: `{"onsetRange": {"low": {"value": 2, "code": "a"}}}`},
+		{name: "string", data: `{"onsetString": "early childhood"}`},
+		{name: "conflicting types", data: `{"onsetDateTime": "2020-06-15", "onsetString": "2020"}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Condition
+			err := json.Unmarshal([]byte(tt.data), &c)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Onset.Time(birthDate); !got.Equal(tt.want) {
+				t.Errorf("Onset.Time() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObservationEffective(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want time.Time
+		err  bool
+	}{
+		{name: "not set", data: `{}`},
+		{name: "dateTime", data: `{"effectiveDateTime": "2024-02-03T09:30:00-05:00"}`, want: time.Date(2024, 2, 3, 14, 30, 0, 0, time.UTC)},
+		{name: "instant", data: `{"effectiveInstant": "2024-02-03T14:30:00Z"}`, want: time.Date(2024, 2, 3, 14, 30, 0, 0, time.UTC)},
+		{name: "period", data: `{"effectivePeriod": {"start": "2024-02-01", "end": "2024-02-03"}}`, want: time.Date(2024, 2, 1, 0, 0, 0, 0, clinicalLocation)},
+		{name: "timing", data: `{"effectiveTiming": {"event": ["2024-02-03"]}}`},
+		{name: "conflicting types", data: `{"effectiveDateTime": "2024-02-03", "effectiveInstant": "2024-02-03T14:30:00Z"}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o Observation
+			err := json.Unmarshal([]byte(tt.data), &o)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := o.Effective.Time(); !got.Equal(tt.want) {
+				t.Errorf("Effective.Time() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Levels of asthma control, following the NAEPP classification
+const (
+	controlWell       string = "well controlled"
+	controlNotWell    string = "not well controlled"
+	controlVeryPoorly string = "very poorly controlled"
+	controlUnknown    string = "unknown"
+)
+
+// Asthma control and severity assessment. Impairment comes from the latest Asthma Control Tool,
+// risk from exacerbations in the past 365 days, and the current NAEPP step
+// from controller history.
+type ControlAssessment struct {
+	// Current NAEPP step from the latest controller or biologic
+	Step      int
+	StepBasis string
+
+	// Impairment from the latest Asthma Control Tool. Tool is "ACT" or "C-ACT" for responses to a
+	// configured scored tool, otherwise "status".
+	Tool       string
+	Score      int64
+	Impairment string
+
+	// Risk from the past 365 days. ED visits and hospitalizations count exacerbations by their most
+	// acute setting.
+	SCSCourses       int
+	Exacerbations    int
+	EDVisits         int
+	Hospitalizations int
+	HighRisk         bool
+
+	// Overall control, severity by the step needed for control and the recommended step
+	Control         string
+	Severity        string
+	RecommendedStep int
+}
+
+// Classifies asthma control and severity. Must be run after exacerbations have been grouped, which
+// also groups steroid orders into courses. The Asthma Control Tool is interpreted as it is fetched.
+func (er *EligibilityRequest) classifyControl() *ControlAssessment {
+	ca := ControlAssessment{}
+	ca.Step, ca.StepBasis = er.treatmentStep()
+	ca.Tool, ca.Score, ca.Impairment = er.impairment()
+
+	// Count SCS courses started in the past year. Courses are sorted most recent first, and the
+	// first order of a course is its last.
+	oneYearAgo := clinicalNow().AddDate(0, 0, -365)
+	for _, course := range er.Data.SteroidCourses {
+		if isAfterDay(course[len(course)-1].AuthoredOn.Time, oneYearAgo) {
+			ca.SCSCourses++
+		}
+	}
+
+	// Count exacerbations by setting
+	exacerbations := er.exacerbationsSince(365)
+	ca.Exacerbations = len(exacerbations)
+	for _, e := range exacerbations {
+		switch e.Setting {
+		case settingInpatient:
+			ca.Hospitalizations++
+		case settingEmergency:
+			ca.EDVisits++
+		}
+	}
+
+	// Two or more exacerbations a year, or any hospitalization, is high risk
+	ca.HighRisk = ca.Exacerbations >= 2 || ca.Hospitalizations > 0
+
+	// Control is the most severe of impairment and risk
+	ca.Control = ca.Impairment
+	if ca.HighRisk && (ca.Control == controlWell || ca.Control == controlUnknown) {
+		ca.Control = controlNotWell
+	}
+
+	// Step up one step when not well controlled and two when very poorly controlled. Severity is
+	// classified by the lowest step needed for control.
+	ca.RecommendedStep = ca.Step
+	switch ca.Control {
+	case controlNotWell:
+		ca.RecommendedStep++
+	case controlVeryPoorly:
+		ca.RecommendedStep += 2
+	}
+	ca.RecommendedStep = min(ca.RecommendedStep, 6)
+	ca.Severity = severity(ca.RecommendedStep)
+
+	return &ca
+}
+
+// Determines the current NAEPP step from the latest controller. Without dosing, ICS-LABA and
+// ICS-formoterol are taken as step 3 and other controllers as step 2.
+func (er *EligibilityRequest) treatmentStep() (int, string) {
+	// Biologics are add-on therapy at steps 5 and 6
+	if len(er.Data.BiologicMedicationRequests) > 0 {
+		return 5, fmt.Sprintf("Biologic (%s).", medicationName(er.Data.BiologicMedicationRequests[0]))
+	}
+	if len(er.Data.ControllerMedicationRequests) == 0 {
+		return 1, "No controller in the past 365 days."
+	}
+
+	// List has been sorted in reverse chronological order
+	mr := er.Data.ControllerMedicationRequests[0]
+	code := mr.MedicationReference.VocabularyCode
+	codes := er.Config.Codes
+	name := medicationName(mr)
+
+	switch {
+	case codes.ICSF.MatchString(code):
+		return 3, fmt.Sprintf("ICS-formoterol (%s).", name)
+	case codes.ICSLABA.MatchString(code):
+		return 3, fmt.Sprintf("ICS-LABA (%s).", name)
+	case codes.ICS.MatchString(code):
+		return 2, fmt.Sprintf("ICS (%s).", name)
+	default:
+		return 2, fmt.Sprintf("Controller (%s).", name)
+	}
+}
+
+// Classifies impairment from the latest Asthma Control Tool, as interpreted by evaluateACT
+func (er *EligibilityRequest) impairment() (string, int64, string) {
+	act := er.Data.AsthmaControlTool
+	switch {
+	case act.Status <= 0:
+		return "", 0, controlUnknown
+	case act.Tool != "":
+		return act.Tool, act.Score, statusControl(act.Status)
+	default:
+		return "status", act.Status, statusControl(act.Status)
+	}
+}
+
+// Interprets an Asthma Control Tool response. Responses to a configured ACT or C-ACT are scored
+// as the sum of their components. Other responses are a status, the highest component value.
+func (c *Config) controlToolResult(o *Observation) (string, int64, string) {
+	var tool string
+	if scores := c.AsthmaControlScores; scores != nil {
+		for _, code := range o.Code.Coding {
+			switch {
+			case slices.Contains(scores.ACT, code.Code):
+				tool = "ACT"
+			case slices.Contains(scores.CACT, code.Code):
+				tool = "C-ACT"
+			}
+		}
+	}
+
+	var value int64
+	for _, component := range o.Component {
+		if tool == "" {
+			value = max(value, component.ValueQuantity.Value)
+		} else {
+			value += component.ValueQuantity.Value
+		}
+	}
+
+	switch tool {
+	case "ACT":
+		return tool, value, scoreControl(value, 20, 15)
+	case "C-ACT":
+		return tool, value, scoreControl(value, 20, 12)
+	default:
+		return "status", value, statusControl(value)
+	}
+}
+
+// Classifies an Asthma Control Tool status, where 1 is controlled and 2 or more uncontrolled
+func statusControl(status int64) string {
+	switch {
+	case status <= 0:
+		return controlUnknown
+	case status == 1:
+		return controlWell
+	case status == 2:
+		return controlNotWell
+	default:
+		return controlVeryPoorly
+	}
+}
+
+// Returns the status matching a level of control, so scored tools are read the same way as status
+// tools
+func controlStatus(control string) int64 {
+	switch control {
+	case controlWell:
+		return 1
+	case controlNotWell:
+		return 2
+	case controlVeryPoorly:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Classifies a control test score. Scores at or above well are well controlled and those at or
+// below veryPoorly are very poorly controlled.
+func scoreControl(score, well, veryPoorly int64) string {
+	switch {
+	case score >= well:
+		return controlWell
+	case score <= veryPoorly:
+		return controlVeryPoorly
+	default:
+		return controlNotWell
+	}
+}
+
+// Returns the NAEPP severity classification for the lowest step needed for control
+func severity(step int) string {
+	switch {
+	case step <= 1:
+		return "intermittent"
+	case step == 2:
+		return "mild persistent"
+	case step <= 4:
+		return "moderate persistent"
+	default:
+		return "severe persistent"
+	}
+}
+
+// Summarizes the assessment for display
+func (ca ControlAssessment) String() string {
+	var b strings.Builder
+
+	b.WriteString(strings.ToUpper(ca.Control[:1]) + ca.Control[1:])
+	if ca.Tool != "" && ca.Tool != "status" {
+		fmt.Fprintf(&b, " (%s %d)", ca.Tool, ca.Score)
+	}
+
+	if ca.Exacerbations > 0 {
+		fmt.Fprintf(&b, ", %d %s in the past year", ca.Exacerbations, plural(ca.Exacerbations, "exacerbation", "exacerbations"))
+
+		var acute []string
+		if ca.EDVisits > 0 {
+			acute = append(acute, fmt.Sprintf("%d ED %s", ca.EDVisits, plural(ca.EDVisits, "visit", "visits")))
+		}
+		if ca.Hospitalizations > 0 {
+			acute = append(acute, fmt.Sprintf("%d %s", ca.Hospitalizations, plural(ca.Hospitalizations, "hospitalization", "hospitalizations")))
+		}
+		if len(acute) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(acute, ", "))
+		}
+	}
+
+	fmt.Fprintf(&b, ". Currently NAEPP step %d; %s severity", ca.Step, ca.Severity)
+	if ca.RecommendedStep > ca.Step {
+		fmt.Fprintf(&b, ", consider step %d", ca.RecommendedStep)
+	}
+	b.WriteString(".")
+
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+// Builds an Asthma Control Tool response for an encounter
+func controlToolResponse(id, encounter string, values ...int64) *Observation {
+	o := &Observation{Focus: []ResourceReference{{Reference: encounter}}}
+	o.Code.Coding = []Coding{{Code: id}}
+	for _, value := range values {
+		var c Component
+		c.ValueQuantity.Value = value
+		o.Component = append(o.Component, c)
+	}
+	return o
+}
+
+func TestControlTool(t *testing.T) {
+	config := &Config{
+		AsthmaControlTool:   map[string]bool{"status": true, "act": true, "c-act": true},
+		AsthmaControlScores: &ControlScoreConfig{ACT: []string{"act"}, CACT: []string{"c-act"}},
+	}
+
+	tests := []struct {
+		name         string
+		response     *Observation
+		tool         string
+		score        int64
+		impairment   string
+		uncontrolled bool
+	}{
+		{name: "controlled status", response: controlToolResponse("status", "e", 1, 1), tool: "status", score: 1, impairment: controlWell},
+		{name: "uncontrolled status", response: controlToolResponse("status", "e", 1, 2), tool: "status", score: 2, impairment: controlNotWell, uncontrolled: true},
+		{name: "ACT well controlled", response: controlToolResponse("act", "e", 4, 4, 4, 4, 5), tool: "ACT", score: 21, impairment: controlWell},
+		{name: "ACT not well controlled", response: controlToolResponse("act", "e", 4, 4, 4, 4, 2), tool: "ACT", score: 18, impairment: controlNotWell, uncontrolled: true},
+		{name: "ACT very poorly controlled", response: controlToolResponse("act", "e", 3, 3, 3, 3, 2), tool: "ACT", score: 14, impairment: controlVeryPoorly, uncontrolled: true},
+		{name: "C-ACT well controlled", response: controlToolResponse("c-act", "e", 3, 3, 3, 3, 3, 3, 3), tool: "C-ACT", score: 21, impairment: controlWell},
+		{name: "C-ACT very poorly controlled", response: controlToolResponse("c-act", "e", 2, 2, 2, 2, 2, 1, 1), tool: "C-ACT", score: 12, impairment: controlVeryPoorly, uncontrolled: true},
+		{name: "five status components", response: controlToolResponse("status", "e", 1, 1, 1, 1, 1), tool: "status", score: 1, impairment: controlWell},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			er := &EligibilityRequest{Config: config, Data: &Data{}}
+			er.Data.AsthmaControlTool.Observations = []*Observation{tt.response}
+			er.evaluateACT()
+
+			tool, score, impairment := er.impairment()
+			if tool != tt.tool || score != tt.score || impairment != tt.impairment {
+				t.Errorf("impairment() = %s, %d, %s, want %s, %d, %s", tool, score, impairment, tt.tool, tt.score, tt.impairment)
+			}
+			if uncontrolled := er.Data.AsthmaControlTool.Status >= 2; uncontrolled != tt.uncontrolled {
+				t.Errorf("uncontrolled = %t, want %t", uncontrolled, tt.uncontrolled)
+			}
+			if _, _, control := config.controlToolResult(tt.response); control != tt.impairment {
+				t.Errorf("controlToolResult() control = %s, want %s", control, tt.impairment)
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	// Name given to the tenant of a single-tenant configuration file
+	defaultTenant string = "default"
+
+	// Writeback backends
+	writebackSmartData string = "epic-smartdata"
+	writebackNone      string = "none"
+)
+
+var (
+	configFile          string = getEnv("CONFIG_FILE", "config.json")
+	configWatchInterval int    = getEnvInt("CONFIG_WATCH_INTERVAL", 10)
+
+	// Active tenant configurations. Swapped atomically on reload so in-flight requests keep the
+	// configuration they started with.
+	activeTenants atomic.Pointer[TenantRegistry]
+
+	// Error from the last reload, if it failed. Cleared when a reload succeeds.
+	reloadErr atomic.Pointer[error]
+
+	// Value sets used when a tenant does not define its own
+	defaultValueSets = ValueSetConfig{
+		AsthmaICD:           os.Getenv("ASTHMA_ICD_REGEX"),
+		EncounterTypeSystem: os.Getenv("ENC_TYPE_SYSTEM_REGEX"),
+		CSNSystem:           os.Getenv("CSN_SYSTEM_REGEX"),
+		AntiAsthmatic:       os.Getenv("ANTI_ASTHMATIC_REGEX"),
+		Biologic:            os.Getenv("BIOLOGIC_REGEX"),
+		Controller:          os.Getenv("CONTROLLER_REGEX"),
+		ICS:                 os.Getenv("ICS_REGEX"),
+		ICSF:                os.Getenv("ICSF_REGEX"),
+		ICSLABA:             os.Getenv("ICS_LABA_REGEX"),
+		SABA:                os.Getenv("SABA_REGEX"),
+		Steroid:             os.Getenv("STEROID_REGEX"),
+		EmergencyEncounter:  getEnv("EMERGENCY_ENCOUNTER_REGEX", "^EMER$"),
+		UrgentCareEncounter: os.Getenv("URGENT_CARE_ENCOUNTER_REGEX"),
+		WellVisit:           os.Getenv("WELL_VISIT_REGEX"),
+		InpatientEncounter:  getEnv("INPATIENT_ENCOUNTER_REGEX", "^(IMP|ACUTE|NONAC)$"),
+	}
+
+	//go:embed config.schema.json
+	configSchemaJSON []byte
+	configSchema     = jsonschema.MustCompileString("config.schema.json", string(configSchemaJSON))
+)
+
+// Returns the active tenant configurations
+func currentTenants() *TenantRegistry {
+	return activeTenants.Load()
+}
+
+// Reads, validates and activates the configuration file
+func loadConfig() error {
+	registry, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+	activeTenants.Store(registry)
+	return nil
+}
+
+// Reads a configuration file and validates it against the schema and the semantic rules. A file
+// without a "tenants" key is treated as the configuration of a single default tenant.
+func readConfig(path string) (*TenantRegistry, error) {
+	// Get configuration file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %s", err)
+	}
+
+	// Validate structure against JSON schema
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %s", err)
+	}
+	if err := configSchema.Validate(raw); err != nil {
+		return nil, fmt.Errorf("config %s does not match schema: %#v", path, err)
+	}
+
+	// Parse JSON data
+	var registry TenantRegistry
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if _, ok := raw["tenants"]; ok {
+		err = decoder.Decode(&registry)
+	} else {
+		var config Config
+		err = decoder.Decode(&config)
+		registry.Tenants = map[string]*Config{defaultTenant: &config}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %s", err)
+	}
+
+	// Validate values
+	if err := registry.validate(); err != nil {
+		return nil, fmt.Errorf("config %s is invalid:\n%v", path, err)
+	}
+
+	return &registry, nil
+}
+
+// Validates each tenant and checks tenants can be told apart
+func (r *TenantRegistry) validate() error {
+	var errs []error
+
+	if len(r.Tenants) == 0 {
+		return errors.New("tenants: at least one tenant is required")
+	}
+
+	// Track which tenant owns each FHIR server and issuer
+	owners := map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(r.Tenants)) {
+		config := r.Tenants[name]
+		config.Name = name
+
+		// Prefix tenant errors with the tenant name when there are several
+		var prefix string
+		if len(r.Tenants) > 1 {
+			prefix = "tenants." + name + "."
+			if len(config.FHIRServers) == 0 && len(config.Issuers) == 0 {
+				errs = append(errs, fmt.Errorf("%sfhirServers: a FHIR server or issuer is required to identify the tenant", prefix))
+			}
+		}
+
+		if err := config.validate(); err != nil {
+			for _, e := range unwrapErrors(err) {
+				errs = append(errs, fmt.Errorf("%s%v", prefix, e))
+			}
+		}
+
+		for _, key := range tenantKeys(config) {
+			if owner, ok := owners[key]; ok && owner != name {
+				errs = append(errs, fmt.Errorf("%s%s is also used by tenant %s", prefix, key, owner))
+			}
+			owners[key] = name
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns the normalized FHIR servers and issuers identifying a tenant
+func tenantKeys(config *Config) []string {
+	var keys []string
+	for _, u := range config.FHIRServers {
+		keys = append(keys, "fhirServer "+normalizeURL(u))
+	}
+	for _, u := range config.Issuers {
+		keys = append(keys, "issuer "+normalizeURL(u))
+	}
+	return keys
+}
+
+// Resolves the tenant from the hook's FHIR server and the token issuer. Either value is enough to
+// identify a tenant, but when both are known they must belong to the same tenant.
+func (r *TenantRegistry) resolve(fhirServer, issuer string) (*Config, error) {
+	// A single-tenant configuration without identifiers serves every request
+	if len(r.Tenants) == 1 {
+		for _, config := range r.Tenants {
+			if len(config.FHIRServers) == 0 && len(config.Issuers) == 0 {
+				return config, nil
+			}
+		}
+	}
+
+	byServer := r.find(fhirServer, func(c *Config) []string { return c.FHIRServers })
+	byIssuer := r.find(issuer, func(c *Config) []string { return c.Issuers })
+
+	switch {
+	case byServer != nil && byIssuer != nil && byServer != byIssuer:
+		return nil, fmt.Errorf("FHIR server %s (tenant %s) does not match issuer %s (tenant %s)", fhirServer, byServer.Name, issuer, byIssuer.Name)
+	case byServer != nil:
+		return byServer, nil
+	case byIssuer != nil:
+		return byIssuer, nil
+	}
+
+	return nil, fmt.Errorf("no tenant configured for FHIR server %q or issuer %q", fhirServer, issuer)
+}
+
+// Resolves the tenant of a SMART app launch. The launch issuer is the FHIR server the app will
+// request, so it must be one of the tenant's FHIR servers, even for a single tenant.
+func (r *TenantRegistry) resolveLaunch(iss string) (*Config, error) {
+	if config := r.find(iss, func(c *Config) []string { return c.FHIRServers }); config != nil {
+		return config, nil
+	}
+	return nil, fmt.Errorf("no tenant configured for FHIR server %q", iss)
+}
+
+func (r *TenantRegistry) find(value string, urls func(*Config) []string) *Config {
+	if value == "" {
+		return nil
+	}
+	value = normalizeURL(value)
+	for _, config := range r.Tenants {
+		for _, u := range urls(config) {
+			if normalizeURL(u) == value {
+				return config
+			}
+		}
+	}
+	return nil
+}
+
+// Normalizes a URL for comparison
+func normalizeURL(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return strings.ToLower(strings.TrimRight(s, "/"))
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	return u.String()
+}
+
+// Flattens errors created with errors.Join
+func unwrapErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// Checks values that can't be expressed in the JSON schema
+func (c *Config) validate() error {
+	var errs []error
+
+	// Default to writing to SmartData
+	switch c.Writeback {
+	case "":
+		c.Writeback = writebackSmartData
+	case writebackSmartData, writebackNone:
+	default:
+		errs = append(errs, fmt.Errorf("writeback: unknown backend %q", c.Writeback))
+	}
+
+	// Compile value sets, falling back to the environment for any that are not set
+	var err error
+	c.Codes, err = c.ValueSets.compile()
+	errs = append(errs, err)
+
+	// Parse card templates and check they render
+	c.Templates, err = c.loadTemplates()
+	errs = append(errs, err)
+
+	// Required IDs must be set and must not be template placeholders
+	required := map[string]string{
+		"alertTextLocation":           c.AlertTextLocation,
+		"asthmaActionPlan.greenZone":  c.AsthmaActionPlan.GreenZone,
+		"asthmaActionPlan.yellowZone": c.AsthmaActionPlan.YellowZone,
+		"observationOID":              c.ObservationOID,
+		"orderSetKey":                 c.OrderSetKey,
+		"systemUser":                  c.SystemUser,
+	}
+	for _, field := range slices.Sorted(maps.Keys(required)) {
+		errs = append(errs, checkID(field, required[field]))
+	}
+
+	// The SMART medication is optional, but must be complete when set
+	if c.SmartMedication != nil {
+		errs = append(errs, checkID("smartMedication.system", c.SmartMedication.System))
+		errs = append(errs, checkID("smartMedication.code", c.SmartMedication.Code))
+	}
+
+	// The action plan document type is optional, but must be complete when set
+	if c.ActionPlanDocumentType != nil {
+		errs = append(errs, checkID("actionPlanDocumentType.system", c.ActionPlanDocumentType.System))
+		errs = append(errs, checkID("actionPlanDocumentType.code", c.ActionPlanDocumentType.Code))
+	}
+
+	// Formulary products must be coded and fit within the age-appropriate maximum
+	for i, product := range c.Formulary {
+		field := fmt.Sprintf("formulary[%d]", i)
+		errs = append(errs, checkID(field+".medication.code", product.Medication.Code))
+		if product.MaxAge > 0 && product.MaxAge < product.MinAge {
+			errs = append(errs, fmt.Errorf("%s: maxAge is less than minAge", field))
+		}
+		for _, step := range product.Steps {
+			if step != 3 && step != 4 {
+				errs = append(errs, fmt.Errorf("%s: SMART is only used at steps 3 and 4, not %d", field, step))
+			}
+		}
+		if product.MaxDailyPuffs > 0 && 2*max(product.Step3Puffs, product.Step4Puffs)+max(product.RelieverPuffs, 1) > product.MaxDailyPuffs {
+			errs = append(errs, fmt.Errorf("%s: maintenance puffs leave no reliever doses within maxDailyPuffs", field))
+		}
+	}
+
+	// Contraindication rules must compile and use a known action. Tenants without rules screen for
+	// allergies to the SMART ingredients.
+	if len(c.Contraindications) == 0 {
+		c.Contraindications = slices.Clone(defaultContraindicationRules)
+	}
+	for i := range c.Contraindications {
+		if err := c.Contraindications[i].compile(); err != nil {
+			errs = append(errs, fmt.Errorf("contraindications[%d]: %w", i, err))
+		}
+	}
+
+	// Primary care attribution needs at least one method, and encounters are only fetched for the
+	// past 730 days
+	if pc := c.PrimaryCare; pc != nil {
+		if err := pc.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("primaryCare.practices: %v", err))
+		}
+		if pc.WellVisitMonths == 0 && !pc.GeneralPractitioner && !pc.CareTeam {
+			errs = append(errs, errors.New("primaryCare: at least one of wellVisitMonths, generalPractitioner or careTeam is required"))
+		}
+		if pc.WellVisitMonths > 0 && c.ValueSets.WellVisit == "" && defaultValueSets.WellVisit == "" {
+			errs = append(errs, errors.New("primaryCare.wellVisitMonths: valueSets.wellVisit is required"))
+		}
+	}
+
+	// Test patient names must compile and tags must be coded
+	if tp := c.TestPatients; tp != nil {
+		if err := tp.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("testPatients.names: %v", err))
+		}
+		for i, tag := range tp.Tags {
+			errs = append(errs, checkID(fmt.Sprintf("testPatients.tags[%d].code", i), tag.Code))
+		}
+	}
+
+	// History limits cannot be negative
+	if h := c.History; h != nil {
+		if h.RetentionDays < 0 {
+			errs = append(errs, errors.New("history.retentionDays: must not be negative"))
+		}
+		if h.MaxPerPatient < 0 {
+			errs = append(errs, errors.New("history.maxPerPatient: must not be negative"))
+		}
+	}
+
+	// Override reasons must be coded
+	for i, reason := range c.OverrideReasons {
+		errs = append(errs, checkID(fmt.Sprintf("overrideReasons[%d].code", i), reason.Code))
+	}
+
+	// The SMART app needs a client ID, a public URL to redirect to and the FHIR servers it may be
+	// launched from
+	if c.SmartApp != nil {
+		errs = append(errs, checkID("smartApp.clientId", c.SmartApp.ClientId))
+		if appBaseURL == "" {
+			errs = append(errs, errors.New("smartApp: APP_BASE_URL must be set to enable the SMART app"))
+		}
+		if len(c.FHIRServers) == 0 {
+			errs = append(errs, errors.New("smartApp: fhirServers must be set to enable the SMART app"))
+		}
+	}
+
+	// Frequency caps need an interval, and snoozes must use a reason offered on the card
+	if s := c.Suppression; s != nil {
+		if s.MaxCards > 0 && s.IntervalDays <= 0 {
+			errs = append(errs, errors.New("suppression.intervalDays: required when maxCards is set"))
+		}
+		for _, code := range slices.Sorted(maps.Keys(s.SnoozeDays)) {
+			if !slices.ContainsFunc(c.overrideReasons(), func(r Coding) bool { return r.Code == code }) {
+				errs = append(errs, fmt.Errorf("suppression.snoozeDays: %s is not an override reason", code))
+			}
+		}
+	}
+
+	// Green and yellow zone must be distinct since observations are routed by code
+	if checkID("", c.AsthmaActionPlan.GreenZone) == nil && c.AsthmaActionPlan.GreenZone == c.AsthmaActionPlan.YellowZone {
+		errs = append(errs, errors.New("asthmaActionPlan: greenZone and yellowZone must be different"))
+	}
+
+	// At least one Asthma Control Tool ID is needed to evaluate control
+	if len(c.AsthmaControlTool) == 0 {
+		errs = append(errs, errors.New("asthmaControlTool: at least one ID is required"))
+	}
+	for _, id := range slices.Sorted(maps.Keys(c.AsthmaControlTool)) {
+		errs = append(errs, checkID("asthmaControlTool", id))
+		if id == c.AsthmaActionPlan.GreenZone || id == c.AsthmaActionPlan.YellowZone {
+			errs = append(errs, fmt.Errorf("asthmaControlTool: %s is also used as an asthma action plan zone", id))
+		}
+	}
+
+	// Scored tools must be Asthma Control Tool IDs, so they are fetched, and use a single score
+	if scores := c.AsthmaControlScores; scores != nil {
+		for _, id := range append(slices.Clone(scores.ACT), scores.CACT...) {
+			if _, ok := c.AsthmaControlTool[id]; !ok {
+				errs = append(errs, fmt.Errorf("asthmaControlScores: %s is not an asthmaControlTool ID", id))
+			}
+		}
+		for _, id := range scores.ACT {
+			if slices.Contains(scores.CACT, id) {
+				errs = append(errs, fmt.Errorf("asthmaControlScores: %s is both an ACT and a C-ACT", id))
+			}
+		}
+	}
+
+	// Each green zone medication must map to at least one yellow zone medication
+	if len(c.AsthmaActionPlan.MedicationMap) == 0 {
+		errs = append(errs, errors.New("asthmaActionPlan.medicationMap: at least one medication is required"))
+	}
+	for _, green := range slices.Sorted(maps.Keys(c.AsthmaActionPlan.MedicationMap)) {
+		field := "asthmaActionPlan.medicationMap"
+		errs = append(errs, checkID(field, green))
+
+		yellow := c.AsthmaActionPlan.MedicationMap[green]
+		if len(yellow) == 0 {
+			errs = append(errs, fmt.Errorf("%s: %s has no yellow zone medications", field, green))
+		}
+		seen := map[string]bool{}
+		for _, id := range yellow {
+			errs = append(errs, checkID(field+"."+green, id))
+			if seen[id] {
+				errs = append(errs, fmt.Errorf("%s.%s: duplicate medication %s", field, green, id))
+			}
+			seen[id] = true
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Compiles the value set regular expressions
+func (v ValueSetConfig) compile() (*ValueSets, error) {
+	var errs []error
+
+	compile := func(field, expr, fallback string) *regexp.Regexp {
+		if expr == "" {
+			expr = fallback
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("valueSets.%s: %v", field, err))
+		}
+		return re
+	}
+
+	d := defaultValueSets
+	sets := &ValueSets{
+		AsthmaICD:           compile("asthmaICD", v.AsthmaICD, d.AsthmaICD),
+		EncounterTypeSystem: compile("encounterTypeSystem", v.EncounterTypeSystem, d.EncounterTypeSystem),
+		CSNSystem:           compile("csnSystem", v.CSNSystem, d.CSNSystem),
+		AntiAsthmatic:       compile("antiAsthmatic", v.AntiAsthmatic, d.AntiAsthmatic),
+		Biologic:            compile("biologic", v.Biologic, d.Biologic),
+		Controller:          compile("controller", v.Controller, d.Controller),
+		ICS:                 compile("ics", v.ICS, orMatchNothing(d.ICS)),
+		ICSF:                compile("icsf", v.ICSF, d.ICSF),
+		ICSLABA:             compile("icsLaba", v.ICSLABA, orMatchNothing(d.ICSLABA)),
+		SABA:                compile("saba", v.SABA, orMatchNothing(d.SABA)),
+		Steroid:             compile("steroid", v.Steroid, d.Steroid),
+		EmergencyEncounter:  compile("emergencyEncounter", v.EmergencyEncounter, orMatchNothing(d.EmergencyEncounter)),
+		UrgentCareEncounter: compile("urgentCareEncounter", v.UrgentCareEncounter, orMatchNothing(d.UrgentCareEncounter)),
+		WellVisit:           compile("wellVisit", v.WellVisit, orMatchNothing(d.WellVisit)),
+		InpatientEncounter:  compile("inpatientEncounter", v.InpatientEncounter, orMatchNothing(d.InpatientEncounter)),
+	}
+
+	return sets, errors.Join(errs...)
+}
+
+// Value sets added after the original environment variables match nothing when unset, rather than
+// everything
+func orMatchNothing(expr string) string {
+	if expr == "" {
+		return `[^\s\S]`
+	}
+	return expr
+}
+
+// Verifies an ID is set and has been replaced from the example configuration
+func checkID(field, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("%s: value is required", field)
+	}
+	if strings.HasPrefix(value, "<") || strings.HasSuffix(value, ">") {
+		return fmt.Errorf("%s: %q is a placeholder", field, value)
+	}
+	return nil
+}
+
+// Reloads the configuration on SIGHUP or when the file changes. An invalid file is logged and the
+// current configuration is kept.
+func watchConfig(stop <-chan struct{}) {
+	// Listen for reload signals
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Poll the file for changes. Polling also catches the symlink swaps used by mounted volumes.
+	ticker := time.NewTicker(time.Duration(configWatchInterval) * time.Second)
+	defer ticker.Stop()
+	lastMod := configModTime()
+
+	for {
+		select {
+		case <-hup:
+			zapLogger.Info("Reloading config after SIGHUP")
+			reloadConfig()
+
+		case <-ticker.C:
+			mod := configModTime()
+			if !mod.Equal(lastMod) {
+				lastMod = mod
+				zapLogger.Info("Reloading config after file change")
+				reloadConfig()
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+func reloadConfig() {
+	if err := loadConfig(); err != nil {
+		reloadErr.Store(&err)
+		zapLogger.Error(fmt.Sprintf("config reload failed, keeping current config: %v", err))
+		return
+	}
+	reloadErr.Store(nil)
+	zapLogger.Info("Config reloaded")
+}
+
+func configModTime() time.Time {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Validates a configuration file and reports the result. Used by the validate-config command.
+func validateConfigCommand(args []string) int {
+	path := configFile
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	if _, err := readConfig(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
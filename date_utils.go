@@ -2,14 +2,51 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/url"
 	"sort"
 	"time"
+
+	// Embed the timezone database, so the clinical timezone loads without one on the host
+	_ "time/tzdata"
+)
+
+var (
+	// Timezone of the clinical setting, used for dates without an offset and for day boundaries
+	clinicalLocation *time.Location = loadClinicalLocation()
+
+	// Current time, replaced in tests
+	timeNow = time.Now
+)
+
+// Precision of a FHIR date, which may be partial (YYYY or YYYY-MM). The zero value is a full dateTime.
+type DatePrecision int
+
+const (
+	PrecisionTime DatePrecision = iota
+	PrecisionDay
+	PrecisionMonth
+	PrecisionYear
 )
 
+// Loads the clinical timezone from CLINICAL_TIMEZONE (an IANA name), defaulting to America/New_York
+func loadClinicalLocation() *time.Location {
+	name := getEnv("CLINICAL_TIMEZONE", "America/New_York")
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("Failed to load CLINICAL_TIMEZONE %q: %v", name, err)
+	}
+	return loc
+}
+
+// Returns the current time in the clinical timezone
+func clinicalNow() time.Time {
+	return timeNow().In(clinicalLocation)
+}
+
 func createTimeWindows(splits int, lookback int) []map[string]string {
 	// Get the start date
-	start := time.Now().AddDate(0, 0, -lookback)
+	start := clinicalNow().AddDate(0, 0, -lookback)
 
 	// Gets initial step size
 	baseStep := lookback / splits
@@ -61,21 +98,23 @@ func addDateParam(window map[string]string, queryParms *url.Values) {
 	}
 }
 
+// Reports whether t1 falls on a later day than t2, with days in the clinical timezone
 func isAfterDay(t1, t2 time.Time) bool {
-	y1, m1, d1 := t1.Date()
-	y2, m2, d2 := t2.Date()
-
-	// Use the local timezone from t1
-	loc := t1.Location()
-
-	// Compare only the year, month, and day in the local timezone
-	return time.Date(y1, m1, d1, 0, 0, 0, 0, loc).After(
-		time.Date(y2, m2, d2, 0, 0, 0, 0, loc),
-	)
+	return toDate(t1).After(toDate(t2))
 }
 
+// Returns midnight of the day t falls on in the clinical timezone
 func toDate(t time.Time) time.Time {
-	return t.Truncate(24 * time.Hour)
+	y, m, d := t.In(clinicalLocation).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, clinicalLocation)
+}
+
+// Returns the number of calendar days from t1 to t2 in the clinical timezone, which is negative if
+// t2 is on an earlier day. Days are counted by date, so daylight saving changes do not shift them.
+func daysBetween(t1, t2 time.Time) int {
+	y1, m1, d1 := t1.In(clinicalLocation).Date()
+	y2, m2, d2 := t2.In(clinicalLocation).Date()
+	return int(time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)).Hours() / 24)
 }
 
 func yearsBetween(start, end time.Time) int {
@@ -93,7 +132,7 @@ func yearsBetween(start, end time.Time) int {
 func filterByTime[T any](list []T, lookback int, getTime func(T) time.Time) []T {
 
 	// Get values from past 365 days
-	today := time.Now()
+	today := clinicalNow()
 	lookbackDate := today.AddDate(0, 0, lookback)
 
 	// Initialize the filtered list
@@ -138,12 +177,9 @@ func groupEvents[T any](events []T, window int, getTime func(T) time.Time, asc b
 	for i := 1; i < len(events); i++ {
 		t1 := getTime(events[i])
 		t2 := getTime(currentGroup[len(currentGroup)-1])
-		// Convert to simple date
-		currentDate := toDate(t1)
-		previousDate := toDate(t2)
 
-		// Check if current event is within the provided window
-		if int((currentDate.Sub(previousDate).Abs().Hours() / 24)) <= window {
+		// Check if current event is within the provided window, in days in the clinical timezone
+		if days := daysBetween(t2, t1); days <= window && days >= -window {
 			currentGroup = append(currentGroup, events[i])
 		} else {
 			grouped = append(grouped, currentGroup)
@@ -157,20 +193,48 @@ func groupEvents[T any](events []T, window int, getTime func(T) time.Time, asc b
 	return grouped
 }
 
-func parseDate(s string) (time.Time, error) {
-	layouts := []string{
-		time.RFC3339,
-		"2006-01-02T15:04:05",
-		"2006-01-02",
+// Parses a FHIR date, dateTime or instant along with its precision. Times with an offset keep
+// their instant; dates and local times are in the clinical timezone. Partial dates (YYYY, YYYY-MM)
+// parse to the start of the year or month.
+func parseDate(s string) (time.Time, DatePrecision, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(clinicalLocation), PrecisionTime, nil
 	}
 
-	var t time.Time
-	var err error
-	for _, layout := range layouts {
-		t, err = time.Parse(layout, s)
-		if err == nil {
-			return t, nil
+	layouts := []struct {
+		layout    string
+		precision DatePrecision
+	}{
+		{"2006-01-02T15:04:05", PrecisionTime},
+		{"2006-01-02", PrecisionDay},
+		{"2006-01", PrecisionMonth},
+		{"2006", PrecisionYear},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, s, clinicalLocation); err == nil {
+			return t, l.precision, nil
 		}
 	}
-	return time.Time{}, fmt.Errorf("unable to parse date: %s", s)
+	return time.Time{}, PrecisionTime, fmt.Errorf("unable to parse date: %s", s)
+}
+
+// Returns the end of the period a date covers: the instant itself for a dateTime, and the last
+// instant of the day, month or year for a date
+func (d Date) End() time.Time {
+	switch d.Precision {
+	case PrecisionDay:
+		return d.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	case PrecisionMonth:
+		return d.AddDate(0, 1, 0).Add(-time.Nanosecond)
+	case PrecisionYear:
+		return d.AddDate(1, 0, 0).Add(-time.Nanosecond)
+	}
+	return d.Time
+}
+
+func maxTime(t1, t2 time.Time) time.Time {
+	if t1.After(t2) {
+		return t1
+	}
+	return t2
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Evaluates dates in America/New_York as of the given time
+func setClinicalClock(t *testing.T, now time.Time) {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, current := clinicalLocation, timeNow
+	clinicalLocation, timeNow = loc, func() time.Time { return now }
+	t.Cleanup(func() { clinicalLocation, timeNow = location, current })
+}
+
+// Parses a FHIR dateTime, failing the test if it is invalid
+func mustParseDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, _, err := parseDate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// An order placed at 9 PM Eastern, written with the Eastern offset and in UTC. In UTC it falls on
+// the next day.
+func eveningOrders(t *testing.T, day time.Time) map[string]time.Time {
+	t.Helper()
+	date := day.Format("2006-01-02")
+	next := day.AddDate(0, 0, 1).Format("2006-01-02")
+	return map[string]time.Time{
+		"eastern": mustParseDate(t, date+"T21:00:00-04:00"),
+		"utc":     mustParseDate(t, next+"T01:00:00Z"),
+	}
+}
+
+// Cutoffs used by the criteria. Evaluated on 2024-10-20, all of them fall in daylight saving time.
+var cutoffs = []int{14, 30, 183, 365}
+
+func TestIsAfterDayCutoffs(t *testing.T) {
+	now := time.Date(2024, 10, 20, 10, 0, 0, 0, time.UTC)
+	setClinicalClock(t, now)
+
+	for _, days := range cutoffs {
+		cutoff := clinicalNow().AddDate(0, 0, -days)
+		for name, order := range eveningOrders(t, cutoff) {
+			t.Run(fmt.Sprintf("%d days/%s/on cutoff", days, name), func(t *testing.T) {
+				if isAfterDay(order, cutoff) {
+					t.Errorf("order %s is on the cutoff day %s, not after it", order, cutoff)
+				}
+			})
+		}
+		for name, order := range eveningOrders(t, cutoff.AddDate(0, 0, 1)) {
+			t.Run(fmt.Sprintf("%d days/%s/after cutoff", days, name), func(t *testing.T) {
+				if !isAfterDay(order, cutoff) {
+					t.Errorf("order %s is the day after the cutoff %s", order, cutoff)
+				}
+			})
+		}
+	}
+}
+
+func TestFilterByTimeCutoffs(t *testing.T) {
+	now := time.Date(2024, 10, 20, 10, 0, 0, 0, time.UTC)
+	setClinicalClock(t, now)
+
+	for _, days := range cutoffs {
+		cutoff := clinicalNow().AddDate(0, 0, -days)
+		tests := []struct {
+			when     string
+			day      time.Time
+			included bool
+		}{
+			{"on cutoff", cutoff, false},
+			{"after cutoff", cutoff.AddDate(0, 0, 1), true},
+		}
+		for _, tt := range tests {
+			for name, order := range eveningOrders(t, tt.day) {
+				t.Run(fmt.Sprintf("%d days/%s/%s", days, name, tt.when), func(t *testing.T) {
+					filtered := filterByTime([]time.Time{order}, -days, func(d time.Time) time.Time { return d })
+					if included := len(filtered) == 1; included != tt.included {
+						t.Errorf("order %s included = %t, want %t", order, included, tt.included)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestGroupEventsCutoffs(t *testing.T) {
+	setClinicalClock(t, time.Date(2024, 10, 20, 10, 0, 0, 0, time.UTC))
+	first := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, window := range cutoffs {
+		tests := []struct {
+			when    string
+			day     time.Time
+			grouped bool
+		}{
+			{"within window", first.AddDate(0, 0, window), true},
+			{"past window", first.AddDate(0, 0, window+1), false},
+		}
+		for _, tt := range tests {
+			for name, order := range eveningOrders(t, tt.day) {
+				t.Run(fmt.Sprintf("%d days/%s/%s", window, name, tt.when), func(t *testing.T) {
+					events := []time.Time{eveningOrders(t, first)[name], order}
+					groups := groupEvents(events, window, func(d time.Time) time.Time { return d }, true)
+					if grouped := len(groups) == 1; grouped != tt.grouped {
+						t.Errorf("orders %s and %s grouped = %t, want %t", events[0], order, grouped, tt.grouped)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDaysBetweenDST(t *testing.T) {
+	setClinicalClock(t, time.Now())
+
+	tests := []struct {
+		name   string
+		t1, t2 string
+		want   int
+	}{
+		{"spring forward, night before to night after", "2024-03-09T23:30:00-05:00", "2024-03-10T23:30:00-04:00", 1},
+		{"spring forward, 23 hour day", "2024-03-10T00:30:00-05:00", "2024-03-10T23:30:00-04:00", 0},
+		{"spring forward, week of evenings", "2024-03-07T21:00:00-05:00", "2024-03-14T21:00:00-04:00", 7},
+		{"fall back, 25 hour day", "2024-11-03T00:30:00-04:00", "2024-11-03T23:30:00-05:00", 0},
+		{"fall back, midnight to midnight", "2024-11-03T00:00:00-04:00", "2024-11-04T00:00:00-05:00", 1},
+		{"fall back, 14 days of evenings", "2024-10-27T21:00:00-04:00", "2024-11-10T21:00:00-05:00", 14},
+		{"fall back, in UTC", "2024-10-28T01:00:00Z", "2024-11-11T02:00:00Z", 14},
+		{"earlier day is negative", "2024-11-10T21:00:00-05:00", "2024-10-27T21:00:00-04:00", -14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := daysBetween(mustParseDate(t, tt.t1), mustParseDate(t, tt.t2)); got != tt.want {
+				t.Errorf("daysBetween(%s, %s) = %d, want %d", tt.t1, tt.t2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	setClinicalClock(t, time.Now())
+	eastern := clinicalLocation
+
+	tests := []struct {
+		input     string
+		want      time.Time
+		precision DatePrecision
+		end       time.Time
+	}{
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, eastern), PrecisionYear, time.Date(2025, 1, 1, 0, 0, 0, -1, eastern)},
+		{"2024-02", time.Date(2024, 2, 1, 0, 0, 0, 0, eastern), PrecisionMonth, time.Date(2024, 3, 1, 0, 0, 0, -1, eastern)},
+		{"2023-02", time.Date(2023, 2, 1, 0, 0, 0, 0, eastern), PrecisionMonth, time.Date(2023, 3, 1, 0, 0, 0, -1, eastern)},
+		{"2024-03-10", time.Date(2024, 3, 10, 0, 0, 0, 0, eastern), PrecisionDay, time.Date(2024, 3, 11, 0, 0, 0, -1, eastern)},
+		{"2024-03-10T08:00:00", time.Date(2024, 3, 10, 8, 0, 0, 0, eastern), PrecisionTime, time.Date(2024, 3, 10, 8, 0, 0, 0, eastern)},
+		{"2024-07-04T21:00:00-04:00", time.Date(2024, 7, 5, 1, 0, 0, 0, time.UTC), PrecisionTime, time.Date(2024, 7, 5, 1, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, precision, err := parseDate(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseDate(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+			if precision != tt.precision {
+				t.Errorf("parseDate(%q) precision = %d, want %d", tt.input, precision, tt.precision)
+			}
+			if end := (Date{Time: got, Precision: precision}).End(); !end.Equal(tt.end) {
+				t.Errorf("End() = %s, want %s", end, tt.end)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "24", "2024-13", "2024-02-30", "March 2024"} {
+		t.Run("invalid "+input, func(t *testing.T) {
+			if _, _, err := parseDate(input); err == nil {
+				t.Errorf("parseDate(%q) succeeded", input)
+			}
+		})
+	}
+}
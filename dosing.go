@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ICS-formoterol product available to a tenant at the NAEPP steps listed, or every step when none
+// are. Puffs are per maintenance or reliever dose, with maintenance doses taken twice daily. Unset
+// values default to NAEPP 2020 and GINA guidance for the patient's age.
+type FormularyProduct struct {
+	Medication    Coding `json:"medication"`
+	MinAge        int    `json:"minAge"`
+	MaxAge        int    `json:"maxAge"`
+	Steps         []int  `json:"steps"`
+	Step3Puffs    int    `json:"step3Puffs"`
+	Step4Puffs    int    `json:"step4Puffs"`
+	RelieverPuffs int    `json:"relieverPuffs"`
+	MaxDailyPuffs int    `json:"maxDailyPuffs"`
+}
+
+// Recommended SMART dose for a patient
+type DosingRecommendation struct {
+	Product          FormularyProduct
+	Step             int
+	MaintenancePuffs int
+	RelieverPuffs    int
+	MaxDailyPuffs    int
+	Basis            string
+}
+
+// Returns the first formulary product for the patient's age and NAEPP step, preferring one
+// matching the given medication codes
+func (c *Config) formularyProduct(age, step int, codes []string) *FormularyProduct {
+	var match *FormularyProduct
+	for i := range c.Formulary {
+		product := &c.Formulary[i]
+		if age < product.MinAge || (product.MaxAge > 0 && age > product.MaxAge) {
+			continue
+		}
+		if len(product.Steps) > 0 && !slices.Contains(product.Steps, step) {
+			continue
+		}
+		if slices.Contains(codes, product.Medication.Code) {
+			return product
+		}
+		if match == nil {
+			match = product
+		}
+	}
+	return match
+}
+
+// Determines the NAEPP step SMART is started at, one above the current step. Patients on an ICS
+// alone, another controller, or no controller start at step 3. Those already on ICS-LABA or
+// ICS-formoterol start at step 4, the highest step SMART is used at.
+func (er *EligibilityRequest) dosingStep() (int, string) {
+	current, basis := er.treatmentStep()
+	step := min(max(current+1, 3), 4)
+	return step, fmt.Sprintf("Current treatment is step %d. %s", current, basis)
+}
+
+// Computes the recommended maintenance and reliever dose from the tenant's formulary, preferring
+// a product matching the given medication codes. Returns nil if no product suits the patient.
+func (er *EligibilityRequest) recommendDose(codes ...string) *DosingRecommendation {
+	age := yearsBetween(er.Context.Patient.BirthDate.Time, clinicalNow())
+	step, basis := er.dosingStep()
+	product := er.Config.formularyProduct(age, step, codes)
+	if product == nil {
+		return nil
+	}
+
+	rec := DosingRecommendation{
+		Product:          *product,
+		Step:             step,
+		MaintenancePuffs: product.Step3Puffs,
+		RelieverPuffs:    product.RelieverPuffs,
+		MaxDailyPuffs:    product.MaxDailyPuffs,
+		Basis:            basis,
+	}
+
+	// Step 3 is one inhalation twice daily and step 4 two inhalations twice daily at all ages
+	if step == 4 {
+		rec.MaintenancePuffs = product.Step4Puffs
+		if rec.MaintenancePuffs == 0 {
+			rec.MaintenancePuffs = 2
+		}
+	} else if rec.MaintenancePuffs == 0 {
+		rec.MaintenancePuffs = 1
+	}
+	if rec.RelieverPuffs == 0 {
+		rec.RelieverPuffs = 1
+	}
+	if rec.MaxDailyPuffs == 0 {
+		rec.MaxDailyPuffs = maxDailyPuffs(age)
+	}
+
+	return &rec
+}
+
+// Summarizes the recommendation for display
+func (d DosingRecommendation) String() string {
+	return fmt.Sprintf("%s: %d %s twice daily and %d %s as needed for symptoms, up to %d puffs a day (NAEPP step %d).",
+		d.Product.Medication.Display, d.MaintenancePuffs, plural(d.MaintenancePuffs, "puff", "puffs"),
+		d.RelieverPuffs, plural(d.RelieverPuffs, "puff", "puffs"), d.MaxDailyPuffs, d.Step)
+}
+
+// Builds a draft MedicationRequest with the recommended maintenance and reliever dosage
+func (d DosingRecommendation) medicationRequest(patId string) MedicationRequestAction {
+	mr := smartMedicationRequest(patId, d.Product.Medication)
+	mr.DosageInstruction = []DosageAction{
+		{
+			Text:            fmt.Sprintf("Maintenance: inhale %d %s twice daily", d.MaintenancePuffs, plural(d.MaintenancePuffs, "puff", "puffs")),
+			AsNeededBoolean: false,
+			Timing:          &DosageTiming{Repeat: DosageRepeat{Frequency: 2, Period: 1, PeriodUnit: "d"}},
+			DoseAndRate:     []DoseAndRate{{DoseQuantity: puffQuantity(d.MaintenancePuffs)}},
+		},
+		{
+			Text: fmt.Sprintf("Reliever: inhale %d %s as needed for asthma symptoms. Do not exceed %d puffs a day including maintenance doses",
+				d.RelieverPuffs, plural(d.RelieverPuffs, "puff", "puffs"), d.MaxDailyPuffs),
+			AsNeededBoolean: true,
+			DoseAndRate:     []DoseAndRate{{DoseQuantity: puffQuantity(d.RelieverPuffs)}},
+			MaxDosePerPeriod: &Ratio{
+				Numerator:   puffQuantity(d.MaxDailyPuffs),
+				Denominator: Quantity{Value: 1, Unit: "day", System: "http://unitsofmeasure.org", Code: "d"},
+			},
+		},
+	}
+	return mr
+}
+
+// Maximum daily inhalations of ICS-formoterol, including maintenance doses. NAEPP 2020 limits
+// children 4-11 years to 8 inhalations and those 12 years and older to 12.
+func maxDailyPuffs(age int) int {
+	if age < 12 {
+		return 8
+	}
+	return 12
+}
+
+func puffQuantity(n int) Quantity {
+	return Quantity{Value: float64(n), Unit: plural(n, "puff", "puffs"), System: "http://unitsofmeasure.org", Code: "{puff}"}
+}
+
+// Adds a suggestion to order the recommended SMART dose
+func (h *Hook) addDosingSuggestion(card int, patId string, rec *DosingRecommendation) {
+	h.Cards[card].Suggestions = append(h.Cards[card].Suggestions, Suggestion{
+		Label: "Order " + rec.Product.Medication.Display + " SMART",
+		Actions: []Action{
+			{
+				Type:        "create",
+				Description: rec.String(),
+				Resource:    rec.medicationRequest(patId),
+			},
+		},
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestFormularyProduct(t *testing.T) {
+	c := &Config{Formulary: []FormularyProduct{
+		{Medication: Coding{Code: "child-80"}, MinAge: 5, MaxAge: 11},
+		{Medication: Coding{Code: "adult-80"}, MinAge: 12, Steps: []int{3}},
+		{Medication: Coding{Code: "adult-160"}, MinAge: 12, Steps: []int{4}, RelieverPuffs: 2},
+		{Medication: Coding{Code: "adult-any"}, MinAge: 12},
+	}}
+
+	tests := []struct {
+		name  string
+		age   int
+		step  int
+		codes []string
+		want  string
+	}{
+		{name: "child step 3", age: 8, step: 3, want: "child-80"},
+		{name: "child step 4", age: 8, step: 4, want: "child-80"},
+		{name: "adult step 3", age: 30, step: 3, want: "adult-80"},
+		{name: "adult step 4", age: 30, step: 4, want: "adult-160"},
+		{name: "adult step 3 prefers code", age: 30, step: 3, codes: []string{"adult-any"}, want: "adult-any"},
+		{name: "adult step 3 ignores code for another step", age: 30, step: 3, codes: []string{"adult-160"}, want: "adult-80"},
+		{name: "too young", age: 3, step: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if product := c.formularyProduct(tt.age, tt.step, tt.codes); product != nil {
+				got = product.Medication.Code
+			}
+			if got != tt.want {
+				t.Errorf("formularyProduct(%d, %d, %v) = %q, want %q", tt.age, tt.step, tt.codes, got, tt.want)
+			}
+		})
+	}
+}
@@ -9,10 +9,10 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"go.elastic.co/apm"
 )
 
 type EligibilityRequest struct {
+	Config   *Config
 	Host     string
 	Context  CDSContext
 	Headers  map[string]string
@@ -20,6 +20,9 @@ type EligibilityRequest struct {
 	Data     *Data
 	Maps     *Maps
 	Criteria Criteria
+
+	// Reason the card was not shown, if it was suppressed
+	Suppression string
 }
 
 type CDSContext struct {
@@ -35,11 +38,15 @@ type Data struct {
 	Encounters                   []*Encounter
 	Medications                  map[string]*Medication
 	MedicationRequests           []*MedicationRequest
+	MedicationDispenses          []*MedicationDispense
+	Allergies                    []*AllergyIntolerance
+	CareTeams                    []*CareTeam
 	BiologicMedicationRequests   []*MedicationRequest
 	ControllerMedicationRequests []*MedicationRequest
 	ControllerCourses            [][]*MedicationRequest
 	SteroidMedicationRequests    []*MedicationRequest
 	SteroidCourses               [][]*MedicationRequest
+	Exacerbations                []Exacerbation
 	ProblemList                  []*Condition
 	HospitalProblems             []*Condition
 	EncDiagnosis                 []*Condition
@@ -53,6 +60,7 @@ type Maps struct {
 	MedicationType map[string]map[string]int
 	CSNStatus      map[string]string
 	EncDate        map[string]Date
+	FullURL        map[string]string
 }
 
 type MedicationMap struct {
@@ -68,6 +76,8 @@ type AsthmaActionPlan struct {
 type AsthmaControlTool struct {
 	Observations []*Observation
 	Status       int64
+	Tool         string
+	Score        int64
 	Date         time.Time
 }
 
@@ -75,9 +85,21 @@ type Criteria struct {
 	AsthmaRegistry *AsthmaRegistryCriteria
 	SmartEligible  *SmartEligibleCriteria
 	SmartInitiated *SmartInitiatedCriteria
+	Control        *ControlAssessment
+	Adherence      *Adherence
+
+	// Allergies and intolerances to SMART medications
+	Contraindications []Contraindication
 }
 
 func eligibility(c echo.Context) error {
+	// Record the request outcome once the response has been built. Any early return is an error.
+	start := time.Now()
+	outcome := outcomeError
+	var tenant string
+	defer func() {
+		observeHook(tenant, "eligibility", outcome, start)
+	}()
 
 	// Obtains raw http request
 	r := c.Request()
@@ -91,6 +113,132 @@ func eligibility(c echo.Context) error {
 		return c.NoContent(http.StatusInternalServerError)
 	}
 
+	// Initialize eligibility request struct
+	er, err := newEligibilityRequest(c, hookRequest)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusForbidden)
+	}
+	tenant = er.Config.Name
+	ctx = er.Context.RequestContext
+
+	// Get patient data
+	if err := er.getData(er.Headers); err != nil {
+		// Reporting of errors is handled in the individual functions so no further reporting done here.
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Evaluate asthma registry and SMART criteria
+	er.evaluate()
+
+	// Check for a contraindication that hides the card, and whether the card has been snoozed or
+	// shown too often for this patient
+	if er.eligibleForSmart() {
+		er.Suppression = er.contraindicated()
+		if er.Suppression == "" {
+			er.Suppression = er.suppression("eligibility")
+		}
+	}
+
+	// Record a snapshot of the evaluation once the response has been built
+	record := er.snapshot("eligibility")
+	defer func() {
+		record.Outcome = outcome
+		er.recordEvaluation(record)
+	}()
+
+	// Log evaluation results
+	er.sendWebLog(er.Criteria.AsthmaRegistry.String())
+
+	// Build basic Hook response
+	hook := Hook{
+		Cards:         []Card{},
+		SystemActions: []SystemActions{},
+	}
+
+	// Patient has asthma and SMART criteria have been evaluated
+	outcome = outcomeNotInRegistry
+	if er.Criteria.AsthmaRegistry.Evaluation {
+		outcome = outcomeNotEligible
+
+		// Patient meets criteria, build care to display to user
+		if er.eligibleForSmart() {
+
+			// Card is suppressed. The SmartData value was written when the card was last shown, or
+			// SMART is contraindicated.
+			if er.Suppression != "" {
+				outcome = outcomeSuppressed
+				return c.JSON(http.StatusOK, hook)
+			}
+
+			// Render card from the tenant's templates
+			summary, detail, err := er.renderCard()
+			if err != nil {
+				logger(ctx, fmt.Errorf("error rendering card: %v (patient: %s)", err, er.Context.Patient.Id))
+				return c.NoContent(http.StatusInternalServerError)
+			}
+
+			// Build RTF
+			alertText := er.buildRTF()
+
+			// Save RTF to EHR using the tenant's writeback backend
+			switch er.Config.Writeback {
+			case writebackNone:
+				writebacks.WithLabelValues(tenant, "skipped").Inc()
+				record.Writeback = "skipped"
+			default:
+				if err := er.saveState(er.Config.AlertTextLocation, alertText, er.Headers); err != nil {
+					writebacks.WithLabelValues(tenant, "failure").Inc()
+					record.Writeback = "failure"
+					outcome = outcomeError
+					logger(ctx, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+					return c.NoContent(http.StatusInternalServerError)
+				}
+				writebacks.WithLabelValues(tenant, "success").Inc()
+				record.Writeback = "success"
+			}
+
+			// Add card
+			hook.addCard(summary, detail)
+
+			// Add link to the SMART app explaining the evaluation
+			hook.addAppLink(0, er.Config)
+
+			// Add order set suggestion
+			hook.addOrderSetSuggestion(0, er.Context.Patient.Id, er.Config.OrderSetKey)
+
+			// Add pre-filled order at the recommended dose
+			if rec := er.recommendDose(); rec != nil {
+				hook.addDosingSuggestion(0, er.Context.Patient.Id, rec)
+			}
+
+			// Warn about allergies to SMART medications
+			hook.annotateContraindications(0, er.Criteria.Contraindications)
+			hook.registerCards("eligibility", er)
+			er.recordShown("eligibility")
+			record.CardShown = true
+			record.CardUUID = hook.Cards[0].UUID
+			outcome = outcomeCardShown
+		}
+	}
+
+	// Return response
+	return c.JSON(http.StatusOK, hook)
+}
+
+// Builds an eligibility request for a hook, resolving the tenant from the FHIR server and the
+// token issuer
+func newEligibilityRequest(c echo.Context, hookRequest HookRequest) (*EligibilityRequest, error) {
+	// Obtains http request context
+	ctx := c.Request().Context()
+
+	// Resolve tenant configuration from the FHIR server and token issuer
+	config, err := currentTenants().resolve(hookRequest.FHIRServer, requestIssuer(c))
+	if err != nil {
+		return nil, err
+	}
+	ctx = withTenant(ctx, config.Name)
+
 	headers := map[string]string{
 		"Authorization":   "Bearer " + hookRequest.FHIRAuthorization.AccessToken,
 		"Accept":          "application/json",
@@ -109,7 +257,8 @@ func eligibility(c echo.Context) error {
 	}
 
 	// Initialize eligibility request struct
-	er := EligibilityRequest{
+	return &EligibilityRequest{
+		Config: config,
 		Data: &Data{
 			Medications: map[string]*Medication{},
 		},
@@ -123,6 +272,7 @@ func eligibility(c echo.Context) error {
 				"steroid":       {},
 			},
 			EncDate: map[string]Date{},
+			FullURL: map[string]string{},
 		},
 		Context: CDSContext{
 			RequestContext: ctx,
@@ -138,83 +288,60 @@ func eligibility(c echo.Context) error {
 		},
 		Headers: headers,
 		Host:    hookRequest.FHIRServer,
-	}
+	}, nil
+}
 
-	// Get patient data
-	if err := er.getData(headers); err != nil {
-		// Reporting of errors is handled in the individual functions so no further reporting done here.
-		return c.NoContent(http.StatusInternalServerError)
-	}
+// Evaluates the asthma registry criteria and, for patients in the registry, the SMART criteria
+func (er *EligibilityRequest) evaluate() {
+	ctx := er.Context.RequestContext
 
 	// Evaluate asthma registry criteria
+	span, _ := startSpan(ctx, "Evaluate Criteria", "Asthma Registry")
 	er.Criteria.AsthmaRegistry = er.asthmaRegistry()
-
-	// Convert struct to map to pass to generateCardDetail function
-	detailMap := structToMap(*er.Criteria.AsthmaRegistry)
-
-	// Build detail string
-	detail, err := generateCardDetail(detailMap, "static/cardDetail.txt")
-	if err != nil {
-		logger(ctx, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
-		return c.NoContent(http.StatusInternalServerError)
-	}
-
-	// Log evaluation results
-	er.sendWebLog(detail)
-
-	// Build basic Hook response
-	hook := Hook{
-		Cards:         []Card{},
-		SystemActions: []SystemActions{},
-	}
+	span.End()
 
 	// Patient has asthma. Evaluate SMART criteria
 	if er.Criteria.AsthmaRegistry.Evaluation {
-
+		span, _ := startSpan(ctx, "Evaluate Criteria", "SMART")
+		er.groupExacerbations()
+		er.Criteria.Adherence = er.adherence()
+		er.Criteria.Contraindications = er.contraindications()
 		er.Criteria.SmartEligible = er.smartEligible()
 		er.Criteria.SmartInitiated = er.smartInitiated()
+		span.End()
 
-		// Patient meets criteria, build care to display to user
-		if er.Criteria.SmartEligible.Evaluation && !er.Criteria.SmartInitiated.Evaluation {
-
-			// Build RTF
-			alertText := er.buildRTF()
-
-			// Save RTF to EHR
-			if err := er.saveState(config.AlertTextLocation, alertText, headers); err != nil {
-				logger(ctx, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
-				return c.NoContent(http.StatusInternalServerError)
-			}
-
-			// Add card
-			hook.addCard(detail)
-
-			// Add order set suggestion
-			hook.addOrderSetSuggestion(0, er.Context.Patient.Id)
-		}
+		// Classify asthma control and severity
+		span, _ = startSpan(ctx, "Evaluate Criteria", "Asthma Control")
+		er.Criteria.Control = er.classifyControl()
+		span.End()
+		observeCriteria(er.Config.Name, er.Criteria.SmartEligible)
 	}
+}
 
-	// Return response
-	return c.JSON(http.StatusOK, hook)
+// Reports whether the patient is eligible for SMART therapy and has not yet started it
+func (er *EligibilityRequest) eligibleForSmart() bool {
+	return er.Criteria.SmartEligible != nil && er.Criteria.SmartEligible.Evaluation && !er.Criteria.SmartInitiated.Evaluation
 }
 
 func (er *EligibilityRequest) getData(headers map[string]string) error {
 	// Create elastic span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Combined")
+	span, _ := startSpan(er.Context.RequestContext, "Get and Parse Data", "Combined")
 	defer span.End()
 
 	// Wait group for "top-level" requests
 	var wg sync.WaitGroup
-	wg.Add(6)
+	wg.Add(9)
 
 	// Create error channel one for each actual call, which includes
-	//   MedicationRequest, Encounter, Appointment, Condition (Problems),
-	//   List (Hospital Problem List), Patient, Condition (Encounter Diagnosis)
-	//   QuestionnaireResponse (Asthma Control Tool), Observation (Asthma Action Plan)
-	errCh := make(chan error, 9)
+	//   MedicationRequest, MedicationDispense, Encounter, Appointment, Condition (Problems),
+	//   List (Hospital Problem List), Patient, Condition (Encounter Diagnosis),
+	//   AllergyIntolerance, CareTeam, QuestionnaireResponse (Asthma Control Tool),
+	//   Observation (Asthma Action Plan)
+	errCh := make(chan error, 12)
 
 	// Get data. Encounter diagnosis requests are nested within the getEncounter function
 	go er.getMedications(&wg, errCh, headers)
+	go er.getMedicationDispenses(&wg, errCh, headers)
 	go er.getPatient(&wg, errCh, headers)
 
 	// Group problems together since both are needed to differentiate problem list from hospital problem list
@@ -229,6 +356,12 @@ func (er *EligibilityRequest) getData(headers map[string]string) error {
 	// Get asthma action plan
 	go er.getAsthmaActionPlan(&wg, errCh, headers)
 
+	// Get allergies to screen for contraindications to SMART
+	go er.getAllergies(&wg, errCh, headers)
+
+	// Get care teams for primary care attribution
+	go er.getCareTeams(&wg, errCh, headers)
+
 	// Wait for data before proceeding and close error channel
 	go func() {
 		wg.Wait()
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	elkQueueSize     int    = getEnvInt("ELK_QUEUE_SIZE", 10000)
+	elkBatchSize     int    = getEnvInt("ELK_BATCH_SIZE", 500)
+	elkFlushInterval int    = getEnvInt("ELK_FLUSH_INTERVAL", 5)
+	elkMaxRetries    int    = getEnvInt("ELK_MAX_RETRIES", 5)
+	elkSpillDir      string = os.Getenv("ELK_SPILL_DIR")
+	elkSpillMaxBytes int    = getEnvInt("ELK_SPILL_MAX_BYTES", 100*1024*1024)
+)
+
+const (
+	// Name of the file used to persist log events that could not be queued or shipped
+	elkSpillFile string = "elk-spill.ndjson"
+
+	// Bounds for the exponential backoff between bulk retries
+	elkBackoffBase time.Duration = 500 * time.Millisecond
+	elkBackoffMax  time.Duration = 30 * time.Second
+)
+
+// Counters describing the state of the ELK shipper
+type ElkStats struct {
+	Queued  int64
+	Sent    int64
+	Spilled int64
+	Dropped int64
+	Failed  int64
+}
+
+// Ships log events to Elasticsearch in batches using the _bulk API. Events are held in a bounded
+// in-memory queue and spilled to disk when the queue is full or Elasticsearch is unavailable.
+type elkShipper struct {
+	url      string
+	queue    chan []byte
+	spill    *elkSpill
+	mu       sync.RWMutex
+	closed   bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	draining sync.WaitGroup
+	drainOn  atomic.Bool
+	leftover [][]byte
+	sent     atomic.Int64
+	spilled  atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+}
+
+// Append-only NDJSON file used to hold events until they can be shipped
+type elkSpill struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+// Bulk API response, limited to the fields needed to identify failed items
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+func newElkShipper(url string) *elkShipper {
+	// Requests made by the background shipper are cancelled when it is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &elkShipper{
+		url:     bulkURL(url),
+		queue:   make(chan []byte, elkQueueSize),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	// Spill to disk is only available when a directory has been provided
+	if elkSpillDir != "" {
+		s.spill = &elkSpill{
+			path:     filepath.Join(elkSpillDir, elkSpillFile),
+			maxBytes: int64(elkSpillMaxBytes),
+		}
+	}
+
+	return s
+}
+
+// Converts the configured ELK document URL into the matching _bulk endpoint
+func bulkURL(url string) string {
+	if url == "" {
+		return ""
+	}
+	url = strings.TrimRight(url, "/")
+	url = strings.TrimSuffix(url, "/_doc")
+	url = strings.TrimSuffix(url, "/_bulk")
+	return url + "/_bulk"
+}
+
+// Starts the background shipper
+func (s *elkShipper) start() {
+	go s.run()
+}
+
+// Adds an event to the queue without blocking. Events that do not fit in the queue are spilled
+// to disk or, if that is not possible, dropped.
+func (s *elkShipper) enqueue(doc []byte) {
+	// Shipping is disabled if no ELK URL has been configured
+	if s.url == "" {
+		return
+	}
+
+	// Hold the read lock so Close cannot stop the shipper between the check and the send
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Shipper is closing, so persist the event for the next start
+	if s.closed {
+		s.spillOrDrop([][]byte{doc})
+		return
+	}
+
+	select {
+	case s.queue <- doc:
+	default:
+		s.spillOrDrop([][]byte{doc})
+	}
+}
+
+func (s *elkShipper) run() {
+	defer close(s.stopped)
+
+	// Shipping is disabled if no ELK URL has been configured
+	if s.url == "" {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(elkFlushInterval) * time.Second)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, elkBatchSize)
+	for {
+		select {
+		case doc := <-s.queue:
+			batch = append(batch, doc)
+			if len(batch) >= elkBatchSize {
+				s.flush(s.ctx, batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.flush(s.ctx, batch)
+				batch = batch[:0]
+			}
+			// Retry anything that was previously spilled once the queue has room again. The spill
+			// is sent in the background so the queue keeps being consumed.
+			if len(s.queue) < cap(s.queue)/2 && s.drainOn.CompareAndSwap(false, true) {
+				s.draining.Add(1)
+				go func() {
+					defer s.draining.Done()
+					defer s.drainOn.Store(false)
+					s.drainSpill(s.ctx)
+				}()
+			}
+
+		case <-s.stop:
+			// Hand the partial batch over to Close
+			s.leftover = batch
+			return
+		}
+	}
+}
+
+// Stops accepting new events and flushes the queue. Anything that cannot be shipped before the
+// context expires is spilled to disk, even once the context has expired.
+func (s *elkShipper) Close(ctx context.Context) error {
+	// No event can be queued once closed is set
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	// Wait for the run loop and any spill drain to exit. Their requests have been cancelled, so
+	// unsent events are spilled promptly.
+	<-s.stopped
+	s.draining.Wait()
+
+	// Shipping is disabled if no ELK URL has been configured
+	if s.url == "" {
+		return nil
+	}
+
+	// Drain the remaining events into batches, spilling them without sending once the context
+	// has expired
+	batch := s.leftover
+	s.leftover = nil
+	for {
+		select {
+		case doc := <-s.queue:
+			batch = append(batch, doc)
+			if len(batch) >= elkBatchSize {
+				s.flushOrSpill(ctx, batch)
+				batch = batch[:0]
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if len(batch) > 0 {
+		s.flushOrSpill(ctx, batch)
+	}
+
+	return ctx.Err()
+}
+
+// Sends a batch while the context is active and spills it otherwise
+func (s *elkShipper) flushOrSpill(ctx context.Context, batch [][]byte) {
+	if ctx.Err() != nil {
+		s.spillOrDrop(batch)
+		return
+	}
+	s.flush(ctx, batch)
+}
+
+// Returns the current shipper counters
+func (s *elkShipper) Stats() ElkStats {
+	return ElkStats{
+		Queued:  int64(len(s.queue)),
+		Sent:    s.sent.Load(),
+		Spilled: s.spilled.Load(),
+		Dropped: s.dropped.Load(),
+		Failed:  s.failed.Load(),
+	}
+}
+
+// Sends a batch, retrying with exponential backoff. Events that are still unsent once retries are
+// exhausted are spilled to disk.
+func (s *elkShipper) flush(ctx context.Context, batch [][]byte) {
+	pending := batch
+	for attempt := 0; ; attempt++ {
+		var err error
+		pending, err = s.send(ctx, pending)
+		if len(pending) == 0 {
+			return
+		}
+
+		if attempt >= elkMaxRetries || ctx.Err() != nil {
+			logger(ctx, fmt.Errorf("elk bulk request failed after %d attempts: %v", attempt+1, err))
+			s.spillOrDrop(pending)
+			return
+		}
+
+		// Wait before retrying, unless the context is cancelled
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Sends a single _bulk request and returns the events that should be retried
+func (s *elkShipper) send(ctx context.Context, batch [][]byte) ([][]byte, error) {
+	// Build NDJSON request body, with an index action before each document
+	var body bytes.Buffer
+	for _, doc := range batch {
+		body.WriteString(`{"index":{}}`)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	// Set headers for request
+	headers := map[string]string{
+		"Content-Type": "application/x-ndjson",
+	}
+
+	// Send bulk request
+	resp, err := sendRequest(ctx, "POST", s.url, nil, headers, &body, 10)
+	if err != nil {
+		return batch, err
+	}
+
+	// Read the body
+	respBody, err := readBody(resp)
+	if err != nil {
+		return batch, err
+	}
+
+	// Retry the whole batch on throttling or server errors
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return batch, fmt.Errorf("status code %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	// Any other failure won't succeed on retry
+	if resp.StatusCode >= 400 {
+		s.failed.Add(int64(len(batch)))
+		logger(ctx, fmt.Errorf("elk bulk request rejected (Status Code - %d): %s", resp.StatusCode, string(respBody)))
+		return nil, nil
+	}
+
+	// Check for individual item failures
+	var bulk bulkResponse
+	if err := json.Unmarshal(respBody, &bulk); err != nil {
+		return batch, fmt.Errorf("unable to parse bulk response: %v", err)
+	}
+	if !bulk.Errors {
+		s.sent.Add(int64(len(batch)))
+		return nil, nil
+	}
+
+	// Keep items that may succeed on retry and count the rest as failed
+	var retry [][]byte
+	for i, item := range bulk.Items {
+		if i >= len(batch) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+				retry = append(retry, batch[i])
+			case result.Status >= 400:
+				s.failed.Add(1)
+				logger(ctx, fmt.Errorf("elk bulk item rejected (Status Code - %d): %s", result.Status, string(result.Error)))
+			default:
+				s.sent.Add(1)
+			}
+		}
+	}
+
+	if len(retry) > 0 {
+		return retry, fmt.Errorf("%d bulk items failed", len(retry))
+	}
+	return nil, nil
+}
+
+// Persists events to the spill file, dropping them if spilling is disabled or fails
+func (s *elkShipper) spillOrDrop(docs [][]byte) {
+	if s.spill == nil {
+		s.dropped.Add(int64(len(docs)))
+		return
+	}
+
+	if err := s.spill.write(docs); err != nil {
+		s.dropped.Add(int64(len(docs)))
+		zapLogger.Error(fmt.Sprintf("failed to spill %d log events: %v", len(docs), err))
+		return
+	}
+	s.spilled.Add(int64(len(docs)))
+}
+
+// Re-sends events previously spilled to disk
+func (s *elkShipper) drainSpill(ctx context.Context) {
+	if s.spill == nil {
+		return
+	}
+
+	docs, err := s.spill.take()
+	if err != nil {
+		zapLogger.Error(fmt.Sprintf("failed to read spilled log events: %v", err))
+		return
+	}
+
+	for _, chunk := range createChunks(docs, elkBatchSize) {
+		if len(chunk) > 0 {
+			s.flushOrSpill(ctx, chunk)
+		}
+	}
+}
+
+func (sp *elkSpill) write(docs [][]byte) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	// Check current size to keep the spill file bounded
+	var size int64
+	if info, err := os.Stat(sp.path); err == nil {
+		size = info.Size()
+	}
+	for _, doc := range docs {
+		size += int64(len(doc)) + 1
+	}
+	if size > sp.maxBytes {
+		return errors.New("spill file is full")
+	}
+
+	f, err := os.OpenFile(sp.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, doc := range docs {
+		w.Write(doc)
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// Reads and removes all spilled events
+func (sp *elkSpill) take() ([][]byte, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	data, err := os.ReadFile(sp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(sp.path); err != nil {
+		return nil, err
+	}
+
+	var docs [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 {
+			docs = append(docs, line)
+		}
+	}
+	return docs, nil
+}
+
+// Exponential backoff with jitter
+func backoff(attempt int) time.Duration {
+	d := elkBackoffBase << attempt
+	if d > elkBackoffMax || d <= 0 {
+		d = elkBackoffMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
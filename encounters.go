@@ -4,9 +4,6 @@ import (
 	"net/url"
 	"sort"
 	"sync"
-	"time"
-
-	"go.elastic.co/apm"
 )
 
 type Encounter struct {
@@ -17,7 +14,9 @@ type Encounter struct {
 	Type         []struct {
 		Coding []Coding `json:"coding"`
 	} `json:"type"`
-	Period           Period `json:"period"`
+	Class            Coding            `json:"class"`
+	Period           Period            `json:"period"`
+	ServiceProvider  ResourceReference `json:"serviceProvider"`
 	AsthmaMedication bool
 	AsthmaDiagnosis  bool
 }
@@ -26,7 +25,7 @@ func (er *EligibilityRequest) getEncounters(wg *sync.WaitGroup, errCh chan<- err
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Encounters")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Encounters")
 	defer span.End()
 
 	// Initialize query parameters
@@ -37,7 +36,7 @@ func (er *EligibilityRequest) getEncounters(wg *sync.WaitGroup, errCh chan<- err
 	requestList := splitRequest(er.Host+"/Encounter", 2, 730, queryParams, headers)
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -70,7 +69,7 @@ func (er *EligibilityRequest) processEncounters() {
 		// Loop to extract CSN, if it exists
 		var csn string
 		for _, identifier := range encounter.Identifier {
-			if csnSystemRegex.MatchString(identifier.System) {
+			if er.Config.Codes.CSNSystem.MatchString(identifier.System) {
 				csn = identifier.Value
 				if encounter.Id == er.Context.Encounter["id"] {
 					er.Context.Encounter["csn"] = csn
@@ -90,7 +89,7 @@ func (er *EligibilityRequest) getEncounterDxList(lookback int) []string {
 	var encIdList []string
 
 	// Initialize date values
-	today := time.Now()
+	today := clinicalNow()
 	oneYearAgo := today.AddDate(0, 0, lookback)
 
 	// Iterate over encounters
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Settings of an exacerbation, from least to most acute
+const (
+	settingOutpatient string = "outpatient"
+	settingUrgentCare string = "urgent care"
+	settingEmergency  string = "emergency"
+	settingInpatient  string = "inpatient"
+)
+
+var settingAcuity = []string{settingOutpatient, settingUrgentCare, settingEmergency, settingInpatient}
+
+// Default number of days between SCS orders or acute care encounters that are counted as the same
+// course or exacerbation
+const defaultExacerbationWindow int = 14
+
+// Asthma exacerbation episode, merged from SCS courses and asthma-coded acute care encounters.
+// Setting is the most acute setting of care. Exacerbations treated in the ED or hospital are
+// severe, and those treated with SCS alone or in urgent care are moderate.
+type Exacerbation struct {
+	Start      time.Time
+	End        time.Time
+	Setting    string
+	Severity   string
+	Steroids   []*MedicationRequest
+	Encounters []*Encounter
+	Diagnoses  []*Condition
+}
+
+// Returns the number of days between events counted as the same exacerbation
+func (c *Config) exacerbationWindow() int {
+	if c.Exacerbations == nil || c.Exacerbations.WindowDays == 0 {
+		return defaultExacerbationWindow
+	}
+	return c.Exacerbations.WindowDays
+}
+
+// Reports whether acute care exacerbations count towards the SMART SCS criteria
+func (c *Config) includeAcuteCare() bool {
+	return c.Exacerbations != nil && c.Exacerbations.IncludeAcuteCare
+}
+
+// Groups SCS orders into courses and merges them with asthma-coded acute care encounters into
+// exacerbation episodes. Both are sorted most recent first.
+func (er *EligibilityRequest) groupExacerbations() {
+	window := er.Config.exacerbationWindow()
+
+	er.Data.SteroidCourses = groupEvents(er.Data.SteroidMedicationRequests, window, func(mr *MedicationRequest) time.Time {
+		return mr.AuthoredOn.Time
+	}, false)
+
+	// Each SCS course is an outpatient exacerbation until merged with an encounter. Courses are
+	// sorted most recent first, as are the orders within them.
+	var events []Exacerbation
+	for _, course := range er.Data.SteroidCourses {
+		events = append(events, Exacerbation{
+			Start:    course[len(course)-1].AuthoredOn.Time,
+			End:      course[0].AuthoredOn.Time,
+			Setting:  settingOutpatient,
+			Steroids: slices.Clone(course),
+		})
+	}
+
+	// Add ED, urgent care and inpatient encounters with an asthma diagnosis
+	codes := er.Config.Codes
+	asthmaEncounters := er.asthmaEncounters()
+	for _, encounter := range er.Data.Encounters {
+		diagnoses := asthmaEncounters[encounter.Id]
+		encounter.AsthmaDiagnosis = len(diagnoses) > 0
+		if !encounter.AsthmaDiagnosis || encounter.Status == "cancelled" || encounter.Status == "noshow" {
+			continue
+		}
+
+		var setting string
+		switch {
+		case encounter.matches(codes.InpatientEncounter):
+			setting = settingInpatient
+		case encounter.matches(codes.EmergencyEncounter):
+			setting = settingEmergency
+		case encounter.matches(codes.UrgentCareEncounter):
+			setting = settingUrgentCare
+		default:
+			continue
+		}
+
+		// A partial end date (YYYY-MM) ends with its month
+		end := encounter.Period.End.End()
+		if end.Before(encounter.Period.Start.Time) {
+			end = encounter.Period.Start.Time
+		}
+		events = append(events, Exacerbation{
+			Start:      encounter.Period.Start.Time,
+			End:        end,
+			Setting:    setting,
+			Encounters: []*Encounter{encounter},
+			Diagnoses:  diagnoses,
+		})
+	}
+
+	// Merge events starting within the window of the end of the previous episode
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	var episodes []Exacerbation
+	for _, event := range events {
+		if n := len(episodes); n > 0 {
+			last := &episodes[n-1]
+			if !toDate(event.Start).After(toDate(last.End).AddDate(0, 0, window)) {
+				last.End = maxTime(last.End, event.End)
+				if slices.Index(settingAcuity, event.Setting) > slices.Index(settingAcuity, last.Setting) {
+					last.Setting = event.Setting
+				}
+				last.Steroids = append(last.Steroids, event.Steroids...)
+				last.Encounters = append(last.Encounters, event.Encounters...)
+				last.Diagnoses = append(last.Diagnoses, event.Diagnoses...)
+				continue
+			}
+		}
+		episodes = append(episodes, event)
+	}
+
+	for i := range episodes {
+		episodes[i].Severity = "moderate"
+		if episodes[i].Setting == settingEmergency || episodes[i].Setting == settingInpatient {
+			episodes[i].Severity = "severe"
+		}
+	}
+	slices.Reverse(episodes)
+
+	er.Data.Exacerbations = episodes
+}
+
+// Returns the exacerbations active within the past number of days, most recent first
+func (er *EligibilityRequest) exacerbationsSince(days int) []Exacerbation {
+	lookback := clinicalNow().AddDate(0, 0, -days)
+
+	var recent []Exacerbation
+	for _, e := range er.Data.Exacerbations {
+		if isAfterDay(e.End, lookback) {
+			recent = append(recent, e)
+		}
+	}
+	return recent
+}
+
+// Returns the asthma encounter diagnoses and hospital problems by encounter ID
+func (er *EligibilityRequest) asthmaEncounters() map[string][]*Condition {
+	ids := map[string][]*Condition{}
+	for _, dx := range append(er.Data.EncDiagnosis, er.Data.HospitalProblems...) {
+		for _, code := range dx.Code.Coding {
+			if er.Config.Codes.AsthmaICD.MatchString(code.Code) {
+				id := strings.TrimPrefix(dx.EncounterReference.Reference, "Encounter/")
+				ids[id] = append(ids[id], dx)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// Reports whether the encounter's class or type matches a value set
+func (e *Encounter) matches(re *regexp.Regexp) bool {
+	if e.Class.Code != "" && re.MatchString(e.Class.Code) {
+		return true
+	}
+	for _, t := range e.Type {
+		for _, code := range t.Coding {
+			if re.MatchString(code.Code) {
+				return true
+			}
+		}
+	}
+	return false
+}
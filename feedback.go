@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	overrideReasonSystem string = "https://github.com/chop-dbhi/smart-asthma/override-reason"
+
+	// Feedback outcomes defined by CDS Hooks
+	feedbackAccepted   string = "accepted"
+	feedbackOverridden string = "overridden"
+)
+
+var (
+	// Namespace for card and suggestion UUIDs
+	cardNamespace = uuid.MustParse("9b1f4c2e-6f3d-4a8e-b5c7-2d0e8f1a3b64")
+
+	// Override reasons offered when a tenant does not configure its own
+	defaultOverrideReasons = []Coding{
+		{System: overrideReasonSystem, Code: "patient-declined", Display: "Patient or family declined"},
+		{System: overrideReasonSystem, Code: "not-appropriate", Display: "Not clinically appropriate"},
+		{System: overrideReasonSystem, Code: "already-addressed", Display: "Already addressed"},
+		{System: overrideReasonSystem, Code: "address-later", Display: "Will address at a future visit"},
+		{System: overrideReasonSystem, Code: snoozeReasonCode, Display: "Remind me in 30 days"},
+	}
+
+	// Feedback for a card issued to another tenant
+	errCardTenant = errors.New("card was issued to another tenant")
+)
+
+// Card returned to the EHR, used to attribute feedback. The same card shown again keeps its UUID,
+// so each record counts the times it was issued.
+type CardRecord struct {
+	UUID            string    `json:"uuid"`
+	Service         string    `json:"service"`
+	Tenant          string    `json:"tenant"`
+	CriteriaVersion string    `json:"criteriaVersion"`
+	PatientId       string    `json:"patientId"`
+	UserId          string    `json:"userId"`
+	Summary         string    `json:"summary"`
+	Suggestions     []string  `json:"suggestions"`
+	Issued          time.Time `json:"issued"`
+	Times           int       `json:"times"`
+}
+
+type FeedbackRequest struct {
+	Feedback []Feedback `json:"feedback"`
+}
+
+type Feedback struct {
+	Card                string               `json:"card"`
+	Outcome             string               `json:"outcome"`
+	AcceptedSuggestions []AcceptedSuggestion `json:"acceptedSuggestions,omitempty"`
+	OverrideReason      *OverrideReason      `json:"overrideReason,omitempty"`
+	OutcomeTimestamp    string               `json:"outcomeTimestamp"`
+}
+
+type AcceptedSuggestion struct {
+	Id string `json:"id"`
+}
+
+type OverrideReason struct {
+	Reason      *Coding `json:"reason,omitempty"`
+	UserComment string  `json:"userComment,omitempty"`
+}
+
+// Feedback as persisted, with the details of the card it refers to
+type FeedbackRecord struct {
+	Feedback
+	Service         string    `json:"service"`
+	Tenant          string    `json:"tenant"`
+	CriteriaVersion string    `json:"criteriaVersion"`
+	PatientId       string    `json:"patientId"`
+	Received        time.Time `json:"received"`
+}
+
+// Aggregate feedback for a service and criteria version
+type FeedbackSummary struct {
+	Service         string         `json:"service"`
+	CriteriaVersion string         `json:"criteriaVersion"`
+	Cards           int            `json:"cards"`
+	Feedback        int            `json:"feedback"`
+	Accepted        int            `json:"accepted"`
+	Overridden      int            `json:"overridden"`
+	AcceptanceRate  float64        `json:"acceptanceRate"`
+	OverrideRate    float64        `json:"overrideRate"`
+	OverrideReasons map[string]int `json:"overrideReasons"`
+}
+
+// Returns the override reasons offered by a tenant
+func (c *Config) overrideReasons() []Coding {
+	if len(c.OverrideReasons) > 0 {
+		return c.OverrideReasons
+	}
+	return defaultOverrideReasons
+}
+
+// Returns the criteria version recorded with cards and feedback
+func (c *Config) criteriaVersion() string {
+	if c.CriteriaVersion == "" {
+		return "unversioned"
+	}
+	return c.CriteriaVersion
+}
+
+// Assigns stable card and suggestion UUIDs, adds override reasons and records the cards so feedback
+// can be attributed. The same card for the same patient always has the same UUID.
+func (h *Hook) registerCards(service string, er *EligibilityRequest) {
+	for i := range h.Cards {
+		card := &h.Cards[i]
+
+		// Derive the card UUID from what the card is about
+		key := strings.Join([]string{er.Config.Name, service, er.Context.Patient.Id, er.Config.criteriaVersion(), card.Summary}, "|")
+		card.UUID = uuid.NewSHA1(cardNamespace, []byte(key)).String()
+		card.OverrideReasons = er.Config.overrideReasons()
+
+		// Derive suggestion UUIDs from the card
+		var suggestions []string
+		for j := range card.Suggestions {
+			suggestion := &card.Suggestions[j]
+			suggestion.UUID = uuid.NewSHA1(uuid.MustParse(card.UUID), []byte(suggestion.Label)).String()
+			suggestions = append(suggestions, suggestion.UUID)
+		}
+
+		record := CardRecord{
+			UUID:            card.UUID,
+			Service:         service,
+			Tenant:          er.Config.Name,
+			CriteriaVersion: er.Config.criteriaVersion(),
+			PatientId:       er.Context.Patient.Id,
+			UserId:          er.Context.User,
+			Summary:         card.Summary,
+			Suggestions:     suggestions,
+			Issued:          time.Now(),
+		}
+		if err := recordCard(record); err != nil {
+			logger(er.Context.RequestContext, fmt.Errorf("failed to record card %s: %v (patient: %s)", card.UUID, err, er.Context.Patient.Id))
+		}
+	}
+}
+
+// Stores a card, counting it as issued once more than the stored record
+func recordCard(record CardRecord) error {
+	return store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(cardBucket))
+
+		var previous CardRecord
+		if data := bucket.Get([]byte(record.UUID)); data != nil {
+			if err := json.Unmarshal(data, &previous); err != nil {
+				return err
+			}
+		}
+		record.Times = previous.Times + 1
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(record.UUID), data)
+	})
+}
+
+func feedback(c echo.Context) error {
+	// Obtains http request context
+	ctx := c.Request().Context()
+
+	// Feedback is only accepted for known services
+	service := c.Param("id")
+	if !slices.Contains(serviceIds(), service) {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	// Feedback is attributed to the tenant of the token issuer
+	config, err := currentTenants().resolve("", requestIssuer(c))
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	var request FeedbackRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		logger(ctx, fmt.Errorf("unable to unmarshal feedback: %v", err))
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	// Validate all feedback before storing any of it
+	var records []FeedbackRecord
+	for _, f := range request.Feedback {
+		record, err := newFeedbackRecord(config, service, f)
+		if errors.Is(err, errCardTenant) {
+			logger(ctx, err)
+			return c.NoContent(http.StatusForbidden)
+		}
+		if err != nil {
+			logger(ctx, err)
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		records = append(records, record)
+	}
+
+	// Persist feedback keyed by card and time received
+	for _, record := range records {
+		key := fmt.Sprintf("%s/%020d", record.Card, record.Received.UnixNano())
+		if err := putJSON(feedbackBucket, key, record); err != nil {
+			logger(ctx, fmt.Errorf("failed to store feedback for card %s: %v", record.Card, err))
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		// Snooze the card if the override reason asks for it
+		if err := snoozeCard(config, record); err != nil {
+			logger(ctx, fmt.Errorf("failed to snooze card %s: %v", record.Card, err))
+		}
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// Validates feedback from a tenant and attaches the details of the card it refers to
+func newFeedbackRecord(config *Config, service string, f Feedback) (FeedbackRecord, error) {
+	record := FeedbackRecord{
+		Feedback: f,
+		Service:  service,
+		Received: time.Now(),
+	}
+
+	if f.Card == "" {
+		return record, fmt.Errorf("feedback is missing a card")
+	}
+	if f.Outcome != feedbackAccepted && f.Outcome != feedbackOverridden {
+		return record, fmt.Errorf("card %s: unknown outcome %q", f.Card, f.Outcome)
+	}
+
+	// Look up the card, which must have been issued to the tenant. Feedback for cards issued
+	// before cards were recorded is attributed to the tenant.
+	var card CardRecord
+	found, err := getJSON(cardBucket, f.Card, &card)
+	if err != nil {
+		return record, err
+	}
+
+	record.Tenant = config.Name
+	if found {
+		if card.Tenant != config.Name {
+			return record, fmt.Errorf("card %s: %w (%s)", f.Card, errCardTenant, config.Name)
+		}
+		record.CriteriaVersion = card.CriteriaVersion
+		record.PatientId = card.PatientId
+	} else {
+		record.CriteriaVersion = "unknown"
+	}
+
+	// Accepted suggestions must belong to the card
+	if found {
+		for _, s := range f.AcceptedSuggestions {
+			if !slices.Contains(card.Suggestions, s.Id) {
+				return record, fmt.Errorf("card %s: unknown suggestion %s", f.Card, s.Id)
+			}
+		}
+	}
+
+	// Override reasons must be one of those offered
+	if f.Outcome == feedbackOverridden && f.OverrideReason != nil && f.OverrideReason.Reason != nil {
+		reason := f.OverrideReason.Reason
+		if !slices.ContainsFunc(config.overrideReasons(), func(r Coding) bool {
+			return r.Code == reason.Code && (reason.System == "" || r.System == reason.System)
+		}) {
+			return record, fmt.Errorf("card %s: unknown override reason %s|%s", f.Card, reason.System, reason.Code)
+		}
+	}
+
+	return record, nil
+}
+
+// Returns acceptance and override rates per service and criteria version
+func feedbackSummary(c echo.Context) error {
+	summaries := map[string]*FeedbackSummary{}
+	get := func(service, version string) *FeedbackSummary {
+		key := service + "|" + version
+		if summaries[key] == nil {
+			summaries[key] = &FeedbackSummary{
+				Service:         service,
+				CriteriaVersion: version,
+				OverrideReasons: map[string]int{},
+			}
+		}
+		return summaries[key]
+	}
+
+	// Count cards issued
+	err := scanJSON(cardBucket, "", func(_ string, data []byte) error {
+		var card CardRecord
+		if err := json.Unmarshal(data, &card); err != nil {
+			return err
+		}
+		get(card.Service, card.CriteriaVersion).Cards += card.Times
+		return nil
+	})
+	if err != nil {
+		logger(c.Request().Context(), err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Count feedback by outcome and override reason
+	err = scanJSON(feedbackBucket, "", func(_ string, data []byte) error {
+		var record FeedbackRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		summary := get(record.Service, record.CriteriaVersion)
+		summary.Feedback++
+		switch record.Outcome {
+		case feedbackAccepted:
+			summary.Accepted++
+		case feedbackOverridden:
+			summary.Overridden++
+			reason := "unspecified"
+			if record.OverrideReason != nil && record.OverrideReason.Reason != nil {
+				reason = record.OverrideReason.Reason.Code
+			}
+			summary.OverrideReasons[reason]++
+		}
+		return nil
+	})
+	if err != nil {
+		logger(c.Request().Context(), err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Calculate rates and sort for stable output
+	var result []*FeedbackSummary
+	for _, summary := range summaries {
+		if summary.Feedback > 0 {
+			summary.AcceptanceRate = float64(summary.Accepted) / float64(summary.Feedback)
+			summary.OverrideRate = float64(summary.Overridden) / float64(summary.Feedback)
+		}
+		result = append(result, summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Service == result[j].Service {
+			return result[i].CriteriaVersion < result[j].CriteriaVersion
+		}
+		return result[i].Service < result[j].Service
+	})
+
+	return c.JSON(http.StatusOK, result)
+}
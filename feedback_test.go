@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Opens a store in a temporary directory for the duration of the test
+func testStore(t *testing.T) {
+	t.Helper()
+	path := storePath
+	storePath = filepath.Join(t.TempDir(), "test.db")
+	if err := openStore(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		closeStore()
+		storePath = path
+	})
+}
+
+func TestRecordCardTimes(t *testing.T) {
+	testStore(t)
+
+	card := CardRecord{UUID: "card", Service: "smart-eligible", Tenant: "a", Issued: time.Now()}
+	for want := 1; want <= 3; want++ {
+		if err := recordCard(card); err != nil {
+			t.Fatal(err)
+		}
+		var stored CardRecord
+		if _, err := getJSON(cardBucket, card.UUID, &stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored.Times != want {
+			t.Errorf("Times = %d, want %d", stored.Times, want)
+		}
+	}
+}
+
+func TestFeedbackTenant(t *testing.T) {
+	testStore(t)
+
+	card := CardRecord{UUID: "card", Service: "smart-eligible", Tenant: "a", CriteriaVersion: "1", PatientId: "p", Issued: time.Now()}
+	if err := recordCard(card); err != nil {
+		t.Fatal(err)
+	}
+	overridden := Feedback{
+		Card:           card.UUID,
+		Outcome:        feedbackOverridden,
+		OverrideReason: &OverrideReason{Reason: &Coding{System: overrideReasonSystem, Code: snoozeReasonCode}},
+	}
+	a, b := &Config{Name: "a"}, &Config{Name: "b"}
+
+	// The card's tenant
+	record, err := newFeedbackRecord(a, card.Service, overridden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Tenant != "a" || record.CriteriaVersion != "1" || record.PatientId != "p" {
+		t.Errorf("record = %+v, want the card's tenant, criteria version and patient", record)
+	}
+	if err := snoozeCard(a, record); err != nil {
+		t.Error(err)
+	}
+
+	// Another tenant
+	if _, err := newFeedbackRecord(b, card.Service, overridden); !errors.Is(err, errCardTenant) {
+		t.Errorf("feedback from another tenant: got %v, want %v", err, errCardTenant)
+	}
+	if err := snoozeCard(b, record); !errors.Is(err, errCardTenant) {
+		t.Errorf("snooze from another tenant: got %v, want %v", err, errCardTenant)
+	}
+
+	// Cards that were not recorded are attributed to the tenant
+	overridden.Card = "unknown"
+	record, err = newFeedbackRecord(b, card.Service, overridden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Tenant != "b" || record.CriteriaVersion != "unknown" {
+		t.Errorf("record = %+v, want tenant b and an unknown criteria version", record)
+	}
+}
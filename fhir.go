@@ -39,7 +39,7 @@ func (er *EligibilityRequest) processFHIRResponse(data []byte) error {
 
 	default:
 		// Assume a single resource
-		return er.parseResource(data)
+		return er.parseResource(data, "")
 	}
 }
 
@@ -51,9 +51,10 @@ func (er *EligibilityRequest) parseBundle(data []byte) error {
 		return fmt.Errorf("error unmarshalling bundle: %s", err)
 	}
 
-	// Send individual entries to parse individually
+	// Send individual entries to parse individually, recording full URLs for resolving references
 	for _, entry := range bundle.Entry {
-		if err := er.parseResource(entry.Resource); err != nil {
+		er.recordFullURL(entry.FullUrl, entry.Resource)
+		if err := er.parseResource(entry.Resource, entry.FullUrl); err != nil {
 			return err
 		}
 	}
@@ -61,7 +62,9 @@ func (er *EligibilityRequest) parseBundle(data []byte) error {
 	return nil
 }
 
-func (er *EligibilityRequest) parseResource(data []byte) error {
+// Parses a single resource. Resources without an ID, such as in transaction Bundles, take their
+// Bundle entry's full URL as their ID.
+func (er *EligibilityRequest) parseResource(data []byte, fullURL string) error {
 
 	// Unmarshal data into struct
 	var resource Resource
@@ -71,6 +74,13 @@ func (er *EligibilityRequest) parseResource(data []byte) error {
 
 	// Unmarshal based on resource type
 	switch resource.ResourceType {
+	case "AllergyIntolerance":
+		var allergy AllergyIntolerance
+		if err := json.Unmarshal(data, &allergy); err != nil {
+			return fmt.Errorf("error unmarshalling AllergyIntolerance: %s:%s", err, string(data))
+		}
+		er.Data.Allergies = append(er.Data.Allergies, &allergy)
+
 	case "Appointment":
 		var appointment Appointment
 		if err := json.Unmarshal(data, &appointment); err != nil {
@@ -78,11 +88,21 @@ func (er *EligibilityRequest) parseResource(data []byte) error {
 		}
 		er.Data.Appointments = append(er.Data.Appointments, &appointment)
 
+	case "CareTeam":
+		var careTeam CareTeam
+		if err := json.Unmarshal(data, &careTeam); err != nil {
+			return fmt.Errorf("error unmarshalling CareTeam: %s:%s", err, string(data))
+		}
+		er.Data.CareTeams = append(er.Data.CareTeams, &careTeam)
+
 	case "Condition":
 		var condition Condition
 		if err := json.Unmarshal(data, &condition); err != nil {
 			return fmt.Errorf("error unmarshalling Condition: %s:%s", err, string(data))
 		}
+		if condition.Id == "" {
+			condition.Id = fullURL
+		}
 		for _, category := range condition.Category {
 			if category.Text == "Problem List Item" {
 				er.Data.ProblemList = append(er.Data.ProblemList, &condition)
@@ -112,6 +132,9 @@ func (er *EligibilityRequest) parseResource(data []byte) error {
 		if err := json.Unmarshal(data, &medication); err != nil {
 			return fmt.Errorf("error unmarshalling Medication: %s:%s", err, string(data))
 		}
+		if medication.Id == "" {
+			medication.Id = fullURL
+		}
 		er.Data.Medications[medication.Id] = &medication
 
 	case "MedicationRequest":
@@ -121,18 +144,25 @@ func (er *EligibilityRequest) parseResource(data []byte) error {
 		}
 		er.Data.MedicationRequests = append(er.Data.MedicationRequests, &medicationRequest)
 
+	case "MedicationDispense":
+		var medicationDispense MedicationDispense
+		if err := json.Unmarshal(data, &medicationDispense); err != nil {
+			return fmt.Errorf("error unmarshalling MedicationDispense: %s:%s", err, string(data))
+		}
+		er.Data.MedicationDispenses = append(er.Data.MedicationDispenses, &medicationDispense)
+
 	case "Observation":
 		var observation Observation
 		if err := json.Unmarshal(data, &observation); err != nil {
 			return fmt.Errorf("error unmarshalling Observation: %s:%s", err, string(data))
 		}
 		for _, code := range observation.Code.Coding {
-			if code.Code == config.AsthmaActionPlan.GreenZone {
+			if code.Code == er.Config.AsthmaActionPlan.GreenZone {
 				er.Data.AsthmaActionPlan.GreenZone = append(er.Data.AsthmaActionPlan.GreenZone, &observation)
-			} else if code.Code == config.AsthmaActionPlan.YellowZone {
+			} else if code.Code == er.Config.AsthmaActionPlan.YellowZone {
 				er.Data.AsthmaActionPlan.YellowZone = append(er.Data.AsthmaActionPlan.YellowZone, &observation)
 			} else {
-				_, ok := config.AsthmaControlTool[code.Code]
+				_, ok := er.Config.AsthmaControlTool[code.Code]
 				if ok {
 					er.Data.AsthmaControlTool.Observations = append(er.Data.AsthmaControlTool.Observations, &observation)
 				}
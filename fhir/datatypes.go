@@ -0,0 +1,262 @@
+package fhir
+
+import (
+	"encoding/json"
+)
+
+// Base of every data type and backbone element. Elements a type does not model are kept in Extra.
+type Element struct {
+	Id        string      `json:"id,omitempty"`
+	Extension []Extension `json:"extension,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Extension with the commonly used value types. Other value types are kept in Extra.
+type Extension struct {
+	Id                   string           `json:"id,omitempty"`
+	URL                  string           `json:"url"`
+	Extension            []Extension      `json:"extension,omitempty"`
+	ValueBoolean         *bool            `json:"valueBoolean,omitempty"`
+	ValueCode            string           `json:"valueCode,omitempty"`
+	ValueCodeableConcept *CodeableConcept `json:"valueCodeableConcept,omitempty"`
+	ValueCoding          *Coding          `json:"valueCoding,omitempty"`
+	ValueDate            string           `json:"valueDate,omitempty"`
+	ValueDateTime        string           `json:"valueDateTime,omitempty"`
+	ValueDecimal         json.Number      `json:"valueDecimal,omitempty"`
+	ValueIdentifier      *Identifier      `json:"valueIdentifier,omitempty"`
+	ValueInstant         string           `json:"valueInstant,omitempty"`
+	ValueInteger         *int             `json:"valueInteger,omitempty"`
+	ValuePeriod          *Period          `json:"valuePeriod,omitempty"`
+	ValueQuantity        *Quantity        `json:"valueQuantity,omitempty"`
+	ValueReference       *Reference       `json:"valueReference,omitempty"`
+	ValueString          string           `json:"valueString,omitempty"`
+	ValueURI             string           `json:"valueUri,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (e *Extension) UnmarshalJSON(data []byte) error {
+	type extension Extension
+	return unmarshalResource(data, (*extension)(e), &e.Extra)
+}
+
+func (e Extension) MarshalJSON() ([]byte, error) {
+	type extension Extension
+	return marshalResource(extension(e), e.Extra)
+}
+
+// Metadata about a resource
+type Meta struct {
+	Element
+	VersionId   string   `json:"versionId,omitempty"`
+	LastUpdated string   `json:"lastUpdated,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Profile     []string `json:"profile,omitempty"`
+	Security    []Coding `json:"security,omitempty"`
+	Tag         []Coding `json:"tag,omitempty"`
+}
+
+// Human-readable summary of a resource
+type Narrative struct {
+	Element
+	Status string `json:"status"`
+	Div    string `json:"div"`
+}
+
+type Coding struct {
+	Element
+	System       string `json:"system,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Code         string `json:"code,omitempty"`
+	Display      string `json:"display,omitempty"`
+	UserSelected *bool  `json:"userSelected,omitempty"`
+}
+
+type CodeableConcept struct {
+	Element
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Reports whether the concept has a coding with the system and code. An empty system matches any.
+func (c *CodeableConcept) HasCoding(system, code string) bool {
+	if c == nil {
+		return false
+	}
+	for _, coding := range c.Coding {
+		if coding.Code == code && (system == "" || coding.System == system) {
+			return true
+		}
+	}
+	return false
+}
+
+type Reference struct {
+	Element
+	Reference  string      `json:"reference,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+type Identifier struct {
+	Element
+	Use      string           `json:"use,omitempty"`
+	Type     *CodeableConcept `json:"type,omitempty"`
+	System   string           `json:"system,omitempty"`
+	Value    string           `json:"value,omitempty"`
+	Period   *Period          `json:"period,omitempty"`
+	Assigner *Reference       `json:"assigner,omitempty"`
+}
+
+// Start and end dateTimes, either of which may be missing
+type Period struct {
+	Element
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Quantity, also used for the Age, Count, Distance, Duration and SimpleQuantity types
+type Quantity struct {
+	Element
+	Value      json.Number `json:"value,omitempty"`
+	Comparator string      `json:"comparator,omitempty"`
+	Unit       string      `json:"unit,omitempty"`
+	System     string      `json:"system,omitempty"`
+	Code       string      `json:"code,omitempty"`
+}
+
+type Range struct {
+	Element
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+}
+
+type Ratio struct {
+	Element
+	Numerator   *Quantity `json:"numerator,omitempty"`
+	Denominator *Quantity `json:"denominator,omitempty"`
+}
+
+type SampledData struct {
+	Element
+	Origin     Quantity    `json:"origin"`
+	Period     json.Number `json:"period"`
+	Factor     json.Number `json:"factor,omitempty"`
+	LowerLimit json.Number `json:"lowerLimit,omitempty"`
+	UpperLimit json.Number `json:"upperLimit,omitempty"`
+	Dimensions int         `json:"dimensions"`
+	Data       string      `json:"data,omitempty"`
+}
+
+type HumanName struct {
+	Element
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Prefix []string `json:"prefix,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+	Period *Period  `json:"period,omitempty"`
+}
+
+type ContactPoint struct {
+	Element
+	System string  `json:"system,omitempty"`
+	Value  string  `json:"value,omitempty"`
+	Use    string  `json:"use,omitempty"`
+	Rank   *int    `json:"rank,omitempty"`
+	Period *Period `json:"period,omitempty"`
+}
+
+type Address struct {
+	Element
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+	Period     *Period  `json:"period,omitempty"`
+}
+
+type Attachment struct {
+	Element
+	ContentType string `json:"contentType,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Data        string `json:"data,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Size        *int   `json:"size,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Creation    string `json:"creation,omitempty"`
+}
+
+type Annotation struct {
+	Element
+	AuthorReference *Reference `json:"authorReference,omitempty"`
+	AuthorString    string     `json:"authorString,omitempty"`
+	Time            string     `json:"time,omitempty"`
+	Text            string     `json:"text"`
+}
+
+type Timing struct {
+	Element
+	Event  []string         `json:"event,omitempty"`
+	Repeat *TimingRepeat    `json:"repeat,omitempty"`
+	Code   *CodeableConcept `json:"code,omitempty"`
+}
+
+type TimingRepeat struct {
+	Element
+	BoundsDuration *Quantity   `json:"boundsDuration,omitempty"`
+	BoundsRange    *Range      `json:"boundsRange,omitempty"`
+	BoundsPeriod   *Period     `json:"boundsPeriod,omitempty"`
+	Count          *int        `json:"count,omitempty"`
+	CountMax       *int        `json:"countMax,omitempty"`
+	Duration       json.Number `json:"duration,omitempty"`
+	DurationMax    json.Number `json:"durationMax,omitempty"`
+	DurationUnit   string      `json:"durationUnit,omitempty"`
+	Frequency      *int        `json:"frequency,omitempty"`
+	FrequencyMax   *int        `json:"frequencyMax,omitempty"`
+	Period         json.Number `json:"period,omitempty"`
+	PeriodMax      json.Number `json:"periodMax,omitempty"`
+	PeriodUnit     string      `json:"periodUnit,omitempty"`
+	DayOfWeek      []string    `json:"dayOfWeek,omitempty"`
+	TimeOfDay      []string    `json:"timeOfDay,omitempty"`
+	When           []string    `json:"when,omitempty"`
+	Offset         *int        `json:"offset,omitempty"`
+}
+
+type Dosage struct {
+	Element
+	ModifierExtension        []Extension         `json:"modifierExtension,omitempty"`
+	Sequence                 *int                `json:"sequence,omitempty"`
+	Text                     string              `json:"text,omitempty"`
+	AdditionalInstruction    []CodeableConcept   `json:"additionalInstruction,omitempty"`
+	PatientInstruction       string              `json:"patientInstruction,omitempty"`
+	Timing                   *Timing             `json:"timing,omitempty"`
+	AsNeededBoolean          *bool               `json:"asNeededBoolean,omitempty"`
+	AsNeededCodeableConcept  *CodeableConcept    `json:"asNeededCodeableConcept,omitempty"`
+	Site                     *CodeableConcept    `json:"site,omitempty"`
+	Route                    *CodeableConcept    `json:"route,omitempty"`
+	Method                   *CodeableConcept    `json:"method,omitempty"`
+	DoseAndRate              []DosageDoseAndRate `json:"doseAndRate,omitempty"`
+	MaxDosePerPeriod         *Ratio              `json:"maxDosePerPeriod,omitempty"`
+	MaxDosePerAdministration *Quantity           `json:"maxDosePerAdministration,omitempty"`
+	MaxDosePerLifetime       *Quantity           `json:"maxDosePerLifetime,omitempty"`
+}
+
+type DosageDoseAndRate struct {
+	Element
+	Type         *CodeableConcept `json:"type,omitempty"`
+	DoseRange    *Range           `json:"doseRange,omitempty"`
+	DoseQuantity *Quantity        `json:"doseQuantity,omitempty"`
+	RateRatio    *Ratio           `json:"rateRatio,omitempty"`
+	RateRange    *Range           `json:"rateRange,omitempty"`
+	RateQuantity *Quantity        `json:"rateQuantity,omitempty"`
+}
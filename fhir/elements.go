@@ -0,0 +1,484 @@
+package fhir
+
+// Keep unmodeled elements of data types and backbone elements, such as primitive extensions
+// (_code) and modifier extensions, through a round trip
+
+func (e *Meta) UnmarshalJSON(data []byte) error {
+	type meta Meta
+	return unmarshalResource(data, (*meta)(e), &e.Extra)
+}
+
+func (e Meta) MarshalJSON() ([]byte, error) {
+	type meta Meta
+	return marshalResource(meta(e), e.Extra)
+}
+
+func (e *Narrative) UnmarshalJSON(data []byte) error {
+	type narrative Narrative
+	return unmarshalResource(data, (*narrative)(e), &e.Extra)
+}
+
+func (e Narrative) MarshalJSON() ([]byte, error) {
+	type narrative Narrative
+	return marshalResource(narrative(e), e.Extra)
+}
+
+func (e *Coding) UnmarshalJSON(data []byte) error {
+	type coding Coding
+	return unmarshalResource(data, (*coding)(e), &e.Extra)
+}
+
+func (e Coding) MarshalJSON() ([]byte, error) {
+	type coding Coding
+	return marshalResource(coding(e), e.Extra)
+}
+
+func (e *CodeableConcept) UnmarshalJSON(data []byte) error {
+	type codeableConcept CodeableConcept
+	return unmarshalResource(data, (*codeableConcept)(e), &e.Extra)
+}
+
+func (e CodeableConcept) MarshalJSON() ([]byte, error) {
+	type codeableConcept CodeableConcept
+	return marshalResource(codeableConcept(e), e.Extra)
+}
+
+func (e *Reference) UnmarshalJSON(data []byte) error {
+	type reference Reference
+	return unmarshalResource(data, (*reference)(e), &e.Extra)
+}
+
+func (e Reference) MarshalJSON() ([]byte, error) {
+	type reference Reference
+	return marshalResource(reference(e), e.Extra)
+}
+
+func (e *Identifier) UnmarshalJSON(data []byte) error {
+	type identifier Identifier
+	return unmarshalResource(data, (*identifier)(e), &e.Extra)
+}
+
+func (e Identifier) MarshalJSON() ([]byte, error) {
+	type identifier Identifier
+	return marshalResource(identifier(e), e.Extra)
+}
+
+func (e *Period) UnmarshalJSON(data []byte) error {
+	type period Period
+	return unmarshalResource(data, (*period)(e), &e.Extra)
+}
+
+func (e Period) MarshalJSON() ([]byte, error) {
+	type period Period
+	return marshalResource(period(e), e.Extra)
+}
+
+func (e *Quantity) UnmarshalJSON(data []byte) error {
+	type quantity Quantity
+	return unmarshalResource(data, (*quantity)(e), &e.Extra)
+}
+
+func (e Quantity) MarshalJSON() ([]byte, error) {
+	type quantity Quantity
+	return marshalResource(quantity(e), e.Extra)
+}
+
+func (e *Range) UnmarshalJSON(data []byte) error {
+	type rangeElement Range
+	return unmarshalResource(data, (*rangeElement)(e), &e.Extra)
+}
+
+func (e Range) MarshalJSON() ([]byte, error) {
+	type rangeElement Range
+	return marshalResource(rangeElement(e), e.Extra)
+}
+
+func (e *Ratio) UnmarshalJSON(data []byte) error {
+	type ratio Ratio
+	return unmarshalResource(data, (*ratio)(e), &e.Extra)
+}
+
+func (e Ratio) MarshalJSON() ([]byte, error) {
+	type ratio Ratio
+	return marshalResource(ratio(e), e.Extra)
+}
+
+func (e *SampledData) UnmarshalJSON(data []byte) error {
+	type sampledData SampledData
+	return unmarshalResource(data, (*sampledData)(e), &e.Extra)
+}
+
+func (e SampledData) MarshalJSON() ([]byte, error) {
+	type sampledData SampledData
+	return marshalResource(sampledData(e), e.Extra)
+}
+
+func (e *HumanName) UnmarshalJSON(data []byte) error {
+	type humanName HumanName
+	return unmarshalResource(data, (*humanName)(e), &e.Extra)
+}
+
+func (e HumanName) MarshalJSON() ([]byte, error) {
+	type humanName HumanName
+	return marshalResource(humanName(e), e.Extra)
+}
+
+func (e *ContactPoint) UnmarshalJSON(data []byte) error {
+	type contactPoint ContactPoint
+	return unmarshalResource(data, (*contactPoint)(e), &e.Extra)
+}
+
+func (e ContactPoint) MarshalJSON() ([]byte, error) {
+	type contactPoint ContactPoint
+	return marshalResource(contactPoint(e), e.Extra)
+}
+
+func (e *Address) UnmarshalJSON(data []byte) error {
+	type address Address
+	return unmarshalResource(data, (*address)(e), &e.Extra)
+}
+
+func (e Address) MarshalJSON() ([]byte, error) {
+	type address Address
+	return marshalResource(address(e), e.Extra)
+}
+
+func (e *Attachment) UnmarshalJSON(data []byte) error {
+	type attachment Attachment
+	return unmarshalResource(data, (*attachment)(e), &e.Extra)
+}
+
+func (e Attachment) MarshalJSON() ([]byte, error) {
+	type attachment Attachment
+	return marshalResource(attachment(e), e.Extra)
+}
+
+func (e *Annotation) UnmarshalJSON(data []byte) error {
+	type annotation Annotation
+	return unmarshalResource(data, (*annotation)(e), &e.Extra)
+}
+
+func (e Annotation) MarshalJSON() ([]byte, error) {
+	type annotation Annotation
+	return marshalResource(annotation(e), e.Extra)
+}
+
+func (e *Timing) UnmarshalJSON(data []byte) error {
+	type timing Timing
+	return unmarshalResource(data, (*timing)(e), &e.Extra)
+}
+
+func (e Timing) MarshalJSON() ([]byte, error) {
+	type timing Timing
+	return marshalResource(timing(e), e.Extra)
+}
+
+func (e *TimingRepeat) UnmarshalJSON(data []byte) error {
+	type timingRepeat TimingRepeat
+	return unmarshalResource(data, (*timingRepeat)(e), &e.Extra)
+}
+
+func (e TimingRepeat) MarshalJSON() ([]byte, error) {
+	type timingRepeat TimingRepeat
+	return marshalResource(timingRepeat(e), e.Extra)
+}
+
+func (e *Dosage) UnmarshalJSON(data []byte) error {
+	type dosage Dosage
+	return unmarshalResource(data, (*dosage)(e), &e.Extra)
+}
+
+func (e Dosage) MarshalJSON() ([]byte, error) {
+	type dosage Dosage
+	return marshalResource(dosage(e), e.Extra)
+}
+
+func (e *DosageDoseAndRate) UnmarshalJSON(data []byte) error {
+	type dosageDoseAndRate DosageDoseAndRate
+	return unmarshalResource(data, (*dosageDoseAndRate)(e), &e.Extra)
+}
+
+func (e DosageDoseAndRate) MarshalJSON() ([]byte, error) {
+	type dosageDoseAndRate DosageDoseAndRate
+	return marshalResource(dosageDoseAndRate(e), e.Extra)
+}
+
+func (e *PatientContact) UnmarshalJSON(data []byte) error {
+	type patientContact PatientContact
+	return unmarshalResource(data, (*patientContact)(e), &e.Extra)
+}
+
+func (e PatientContact) MarshalJSON() ([]byte, error) {
+	type patientContact PatientContact
+	return marshalResource(patientContact(e), e.Extra)
+}
+
+func (e *PatientCommunication) UnmarshalJSON(data []byte) error {
+	type patientCommunication PatientCommunication
+	return unmarshalResource(data, (*patientCommunication)(e), &e.Extra)
+}
+
+func (e PatientCommunication) MarshalJSON() ([]byte, error) {
+	type patientCommunication PatientCommunication
+	return marshalResource(patientCommunication(e), e.Extra)
+}
+
+func (e *PatientLink) UnmarshalJSON(data []byte) error {
+	type patientLink PatientLink
+	return unmarshalResource(data, (*patientLink)(e), &e.Extra)
+}
+
+func (e PatientLink) MarshalJSON() ([]byte, error) {
+	type patientLink PatientLink
+	return marshalResource(patientLink(e), e.Extra)
+}
+
+func (e *EncounterStatusHistory) UnmarshalJSON(data []byte) error {
+	type encounterStatusHistory EncounterStatusHistory
+	return unmarshalResource(data, (*encounterStatusHistory)(e), &e.Extra)
+}
+
+func (e EncounterStatusHistory) MarshalJSON() ([]byte, error) {
+	type encounterStatusHistory EncounterStatusHistory
+	return marshalResource(encounterStatusHistory(e), e.Extra)
+}
+
+func (e *EncounterClassHistory) UnmarshalJSON(data []byte) error {
+	type encounterClassHistory EncounterClassHistory
+	return unmarshalResource(data, (*encounterClassHistory)(e), &e.Extra)
+}
+
+func (e EncounterClassHistory) MarshalJSON() ([]byte, error) {
+	type encounterClassHistory EncounterClassHistory
+	return marshalResource(encounterClassHistory(e), e.Extra)
+}
+
+func (e *EncounterParticipant) UnmarshalJSON(data []byte) error {
+	type encounterParticipant EncounterParticipant
+	return unmarshalResource(data, (*encounterParticipant)(e), &e.Extra)
+}
+
+func (e EncounterParticipant) MarshalJSON() ([]byte, error) {
+	type encounterParticipant EncounterParticipant
+	return marshalResource(encounterParticipant(e), e.Extra)
+}
+
+func (e *EncounterDiagnosis) UnmarshalJSON(data []byte) error {
+	type encounterDiagnosis EncounterDiagnosis
+	return unmarshalResource(data, (*encounterDiagnosis)(e), &e.Extra)
+}
+
+func (e EncounterDiagnosis) MarshalJSON() ([]byte, error) {
+	type encounterDiagnosis EncounterDiagnosis
+	return marshalResource(encounterDiagnosis(e), e.Extra)
+}
+
+func (e *EncounterHospitalization) UnmarshalJSON(data []byte) error {
+	type encounterHospitalization EncounterHospitalization
+	return unmarshalResource(data, (*encounterHospitalization)(e), &e.Extra)
+}
+
+func (e EncounterHospitalization) MarshalJSON() ([]byte, error) {
+	type encounterHospitalization EncounterHospitalization
+	return marshalResource(encounterHospitalization(e), e.Extra)
+}
+
+func (e *EncounterLocation) UnmarshalJSON(data []byte) error {
+	type encounterLocation EncounterLocation
+	return unmarshalResource(data, (*encounterLocation)(e), &e.Extra)
+}
+
+func (e EncounterLocation) MarshalJSON() ([]byte, error) {
+	type encounterLocation EncounterLocation
+	return marshalResource(encounterLocation(e), e.Extra)
+}
+
+func (e *ConditionStage) UnmarshalJSON(data []byte) error {
+	type conditionStage ConditionStage
+	return unmarshalResource(data, (*conditionStage)(e), &e.Extra)
+}
+
+func (e ConditionStage) MarshalJSON() ([]byte, error) {
+	type conditionStage ConditionStage
+	return marshalResource(conditionStage(e), e.Extra)
+}
+
+func (e *ConditionEvidence) UnmarshalJSON(data []byte) error {
+	type conditionEvidence ConditionEvidence
+	return unmarshalResource(data, (*conditionEvidence)(e), &e.Extra)
+}
+
+func (e ConditionEvidence) MarshalJSON() ([]byte, error) {
+	type conditionEvidence ConditionEvidence
+	return marshalResource(conditionEvidence(e), e.Extra)
+}
+
+func (e *MedicationIngredient) UnmarshalJSON(data []byte) error {
+	type medicationIngredient MedicationIngredient
+	return unmarshalResource(data, (*medicationIngredient)(e), &e.Extra)
+}
+
+func (e MedicationIngredient) MarshalJSON() ([]byte, error) {
+	type medicationIngredient MedicationIngredient
+	return marshalResource(medicationIngredient(e), e.Extra)
+}
+
+func (e *MedicationBatch) UnmarshalJSON(data []byte) error {
+	type medicationBatch MedicationBatch
+	return unmarshalResource(data, (*medicationBatch)(e), &e.Extra)
+}
+
+func (e MedicationBatch) MarshalJSON() ([]byte, error) {
+	type medicationBatch MedicationBatch
+	return marshalResource(medicationBatch(e), e.Extra)
+}
+
+func (e *MedicationRequestDispenseRequest) UnmarshalJSON(data []byte) error {
+	type medicationRequestDispenseRequest MedicationRequestDispenseRequest
+	return unmarshalResource(data, (*medicationRequestDispenseRequest)(e), &e.Extra)
+}
+
+func (e MedicationRequestDispenseRequest) MarshalJSON() ([]byte, error) {
+	type medicationRequestDispenseRequest MedicationRequestDispenseRequest
+	return marshalResource(medicationRequestDispenseRequest(e), e.Extra)
+}
+
+func (e *MedicationRequestSubstitution) UnmarshalJSON(data []byte) error {
+	type medicationRequestSubstitution MedicationRequestSubstitution
+	return unmarshalResource(data, (*medicationRequestSubstitution)(e), &e.Extra)
+}
+
+func (e MedicationRequestSubstitution) MarshalJSON() ([]byte, error) {
+	type medicationRequestSubstitution MedicationRequestSubstitution
+	return marshalResource(medicationRequestSubstitution(e), e.Extra)
+}
+
+func (e *MedicationDispensePerformer) UnmarshalJSON(data []byte) error {
+	type medicationDispensePerformer MedicationDispensePerformer
+	return unmarshalResource(data, (*medicationDispensePerformer)(e), &e.Extra)
+}
+
+func (e MedicationDispensePerformer) MarshalJSON() ([]byte, error) {
+	type medicationDispensePerformer MedicationDispensePerformer
+	return marshalResource(medicationDispensePerformer(e), e.Extra)
+}
+
+func (e *MedicationDispenseSubstitution) UnmarshalJSON(data []byte) error {
+	type medicationDispenseSubstitution MedicationDispenseSubstitution
+	return unmarshalResource(data, (*medicationDispenseSubstitution)(e), &e.Extra)
+}
+
+func (e MedicationDispenseSubstitution) MarshalJSON() ([]byte, error) {
+	type medicationDispenseSubstitution MedicationDispenseSubstitution
+	return marshalResource(medicationDispenseSubstitution(e), e.Extra)
+}
+
+func (e *ObservationReferenceRange) UnmarshalJSON(data []byte) error {
+	type observationReferenceRange ObservationReferenceRange
+	return unmarshalResource(data, (*observationReferenceRange)(e), &e.Extra)
+}
+
+func (e ObservationReferenceRange) MarshalJSON() ([]byte, error) {
+	type observationReferenceRange ObservationReferenceRange
+	return marshalResource(observationReferenceRange(e), e.Extra)
+}
+
+func (e *ObservationComponent) UnmarshalJSON(data []byte) error {
+	type observationComponent ObservationComponent
+	return unmarshalResource(data, (*observationComponent)(e), &e.Extra)
+}
+
+func (e ObservationComponent) MarshalJSON() ([]byte, error) {
+	type observationComponent ObservationComponent
+	return marshalResource(observationComponent(e), e.Extra)
+}
+
+func (e *AllergyIntoleranceReaction) UnmarshalJSON(data []byte) error {
+	type allergyIntoleranceReaction AllergyIntoleranceReaction
+	return unmarshalResource(data, (*allergyIntoleranceReaction)(e), &e.Extra)
+}
+
+func (e AllergyIntoleranceReaction) MarshalJSON() ([]byte, error) {
+	type allergyIntoleranceReaction AllergyIntoleranceReaction
+	return marshalResource(allergyIntoleranceReaction(e), e.Extra)
+}
+
+func (e *CareTeamParticipant) UnmarshalJSON(data []byte) error {
+	type careTeamParticipant CareTeamParticipant
+	return unmarshalResource(data, (*careTeamParticipant)(e), &e.Extra)
+}
+
+func (e CareTeamParticipant) MarshalJSON() ([]byte, error) {
+	type careTeamParticipant CareTeamParticipant
+	return marshalResource(careTeamParticipant(e), e.Extra)
+}
+
+func (e *ListEntry) UnmarshalJSON(data []byte) error {
+	type listEntry ListEntry
+	return unmarshalResource(data, (*listEntry)(e), &e.Extra)
+}
+
+func (e ListEntry) MarshalJSON() ([]byte, error) {
+	type listEntry ListEntry
+	return marshalResource(listEntry(e), e.Extra)
+}
+
+func (e *AppointmentParticipant) UnmarshalJSON(data []byte) error {
+	type appointmentParticipant AppointmentParticipant
+	return unmarshalResource(data, (*appointmentParticipant)(e), &e.Extra)
+}
+
+func (e AppointmentParticipant) MarshalJSON() ([]byte, error) {
+	type appointmentParticipant AppointmentParticipant
+	return marshalResource(appointmentParticipant(e), e.Extra)
+}
+
+func (e *BundleLink) UnmarshalJSON(data []byte) error {
+	type bundleLink BundleLink
+	return unmarshalResource(data, (*bundleLink)(e), &e.Extra)
+}
+
+func (e BundleLink) MarshalJSON() ([]byte, error) {
+	type bundleLink BundleLink
+	return marshalResource(bundleLink(e), e.Extra)
+}
+
+func (e *BundleEntry) UnmarshalJSON(data []byte) error {
+	type bundleEntry BundleEntry
+	return unmarshalResource(data, (*bundleEntry)(e), &e.Extra)
+}
+
+func (e BundleEntry) MarshalJSON() ([]byte, error) {
+	type bundleEntry BundleEntry
+	return marshalResource(bundleEntry(e), e.Extra)
+}
+
+func (e *BundleEntrySearch) UnmarshalJSON(data []byte) error {
+	type bundleEntrySearch BundleEntrySearch
+	return unmarshalResource(data, (*bundleEntrySearch)(e), &e.Extra)
+}
+
+func (e BundleEntrySearch) MarshalJSON() ([]byte, error) {
+	type bundleEntrySearch BundleEntrySearch
+	return marshalResource(bundleEntrySearch(e), e.Extra)
+}
+
+func (e *BundleEntryRequest) UnmarshalJSON(data []byte) error {
+	type bundleEntryRequest BundleEntryRequest
+	return unmarshalResource(data, (*bundleEntryRequest)(e), &e.Extra)
+}
+
+func (e BundleEntryRequest) MarshalJSON() ([]byte, error) {
+	type bundleEntryRequest BundleEntryRequest
+	return marshalResource(bundleEntryRequest(e), e.Extra)
+}
+
+func (e *BundleEntryResponse) UnmarshalJSON(data []byte) error {
+	type bundleEntryResponse BundleEntryResponse
+	return unmarshalResource(data, (*bundleEntryResponse)(e), &e.Extra)
+}
+
+func (e BundleEntryResponse) MarshalJSON() ([]byte, error) {
+	type bundleEntryResponse BundleEntryResponse
+	return marshalResource(bundleEntryResponse(e), e.Extra)
+}
@@ -0,0 +1,104 @@
+// Package fhir models the FHIR R4 resources used by the service.
+//
+// Optional elements are pointers or omitted when empty, decimals keep their original precision,
+// and choice type elements (value[x]) have a field per type. Elements a resource, data type or
+// backbone element does not model, such as primitive extensions (_birthDate, _code), are kept in
+// its Extra and written back out, so resources survive a round trip through JSON.
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Element names modeled by each resource type
+var knownElements sync.Map
+
+// Decodes a resource of the given type
+func Decode[T any](data []byte) (*T, error) {
+	var resource T
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// Decodes a resource, keeping the elements it does not model in extra
+func unmarshalResource(data []byte, v any, extra *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var elements map[string]json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+
+	known := elementNames(reflect.TypeOf(v).Elem())
+	*extra = nil
+	for name, value := range elements {
+		if known[name] {
+			continue
+		}
+		if *extra == nil {
+			*extra = map[string]json.RawMessage{}
+		}
+		(*extra)[name] = value
+	}
+
+	return nil
+}
+
+// Encodes a resource along with the elements it does not model
+func marshalResource(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var elements map[string]json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := elements[name]; ok {
+			return nil, fmt.Errorf("%s is both modeled and in Extra", name)
+		}
+		elements[name] = value
+	}
+
+	return json.Marshal(elements)
+}
+
+// Returns the JSON names of a struct's fields, including those of embedded structs
+func elementNames(t reflect.Type) map[string]bool {
+	if names, ok := knownElements.Load(t); ok {
+		return names.(map[string]bool)
+	}
+
+	names := map[string]bool{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded := range elementNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+
+	knownElements.Store(t, names)
+	return names
+}
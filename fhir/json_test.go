@@ -0,0 +1,97 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Decodes JSON for comparison, keeping numbers as written
+func decodeAny(t *testing.T, data []byte) any {
+	t.Helper()
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// Decodes a resource and encodes it again
+func roundTrip[T any](data []byte) ([]byte, error) {
+	resource, err := Decode[T](data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resource)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		file      string
+		roundTrip func([]byte) ([]byte, error)
+	}{
+		{"patient-example.json", roundTrip[Patient]},
+		{"observation-example.json", roundTrip[Observation]},
+		{"medicationrequest-example.json", roundTrip[MedicationRequest]},
+		{"condition-example.json", roundTrip[Condition]},
+		{"bundle-example.json", roundTrip[Bundle]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := tt.roundTrip(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := decodeAny(t, data), decodeAny(t, out); !reflect.DeepEqual(want, got) {
+				t.Errorf("round trip changed the resource\nwant: %s\ngot:  %s", data, out)
+			}
+		})
+	}
+}
+
+func TestNestedExtra(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "observation-example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := Decode[Observation](data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Primitive extensions and modifier extensions of nested elements
+	if _, ok := o.Code.Coding[0].Extra["_code"]; !ok {
+		t.Error("code.coding[0]._code was not kept")
+	}
+	if _, ok := o.Subject.Extra["_reference"]; !ok {
+		t.Error("subject._reference was not kept")
+	}
+	if _, ok := o.Component[0].Extra["modifierExtension"]; !ok {
+		t.Error("component[0].modifierExtension was not kept")
+	}
+
+	// Modeled elements are not duplicated
+	if _, ok := o.Code.Coding[0].Extra["code"]; ok {
+		t.Error("code.coding[0].code is modeled but was kept in Extra")
+	}
+	if o.Code.Coding[1].Extra != nil {
+		t.Errorf("code.coding[1] has no unmodeled elements, got %v", o.Code.Coding[1].Extra)
+	}
+}
+
+func TestMarshalConflict(t *testing.T) {
+	c := Coding{Code: "J45.40"}
+	c.Extra = map[string]json.RawMessage{"code": json.RawMessage(`"J45.50"`)}
+	if _, err := json.Marshal(c); err == nil {
+		t.Error("expected an error for an element both modeled and in Extra")
+	}
+}
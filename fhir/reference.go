@@ -0,0 +1,45 @@
+package fhir
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Splits a relative or absolute literal reference into the resource type and ID, dropping any
+// version (Patient/123/_history/2). Other references, such as contained (#id) or urn:uuid
+// references, are not split.
+func ParseReference(ref string) (resourceType, id string, ok bool) {
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "urn:") {
+		return "", "", false
+	}
+
+	// Drop the version
+	if before, _, found := strings.Cut(ref, "/_history/"); found {
+		ref = before
+	}
+
+	parts := strings.Split(strings.TrimSuffix(ref, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	resourceType, id = parts[len(parts)-2], parts[len(parts)-1]
+	if resourceType == "" || id == "" || !unicode.IsUpper(rune(resourceType[0])) {
+		return "", "", false
+	}
+
+	return resourceType, id, true
+}
+
+// Returns the resource type and ID the reference points to, falling back to the reference's type
+func (r Reference) Target() (resourceType, id string) {
+	resourceType, id, ok := ParseReference(r.Reference)
+	if !ok {
+		return r.Type, ""
+	}
+	return resourceType, id
+}
+
+// Reports whether the reference points to a resource contained in the referencing resource
+func (r Reference) IsContained() bool {
+	return strings.HasPrefix(r.Reference, "#")
+}
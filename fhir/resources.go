@@ -0,0 +1,709 @@
+package fhir
+
+import (
+	"encoding/json"
+)
+
+// Elements shared by every resource. Extra holds elements the resource does not model.
+type DomainResource struct {
+	ResourceType      string        `json:"resourceType"`
+	Id                string        `json:"id,omitempty"`
+	Meta              *Meta         `json:"meta,omitempty"`
+	ImplicitRules     string        `json:"implicitRules,omitempty"`
+	Language          string        `json:"language,omitempty"`
+	Text              *Narrative    `json:"text,omitempty"`
+	Contained         []RawResource `json:"contained,omitempty"`
+	Extension         []Extension   `json:"extension,omitempty"`
+	ModifierExtension []Extension   `json:"modifierExtension,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Returns the contained resource with the ID, if any
+func (d *DomainResource) FindContained(id string) (RawResource, bool) {
+	if d == nil {
+		return RawResource{}, false
+	}
+	for _, resource := range d.Contained {
+		if _, rid := resource.Header(); rid == id {
+			return resource, true
+		}
+	}
+	return RawResource{}, false
+}
+
+// Resource of any type, kept as JSON until decoded
+type RawResource struct {
+	json.RawMessage
+}
+
+// Returns the resource's type and ID
+func (r RawResource) Header() (resourceType, id string) {
+	var header struct {
+		ResourceType string `json:"resourceType"`
+		Id           string `json:"id"`
+	}
+	if err := json.Unmarshal(r.RawMessage, &header); err != nil {
+		return "", ""
+	}
+	return header.ResourceType, header.Id
+}
+
+// Decodes the resource into v
+func (r RawResource) Decode(v any) error {
+	return json.Unmarshal(r.RawMessage, v)
+}
+
+type Patient struct {
+	DomainResource
+	Identifier           []Identifier           `json:"identifier,omitempty"`
+	Active               *bool                  `json:"active,omitempty"`
+	Name                 []HumanName            `json:"name,omitempty"`
+	Telecom              []ContactPoint         `json:"telecom,omitempty"`
+	Gender               string                 `json:"gender,omitempty"`
+	BirthDate            string                 `json:"birthDate,omitempty"`
+	DeceasedBoolean      *bool                  `json:"deceasedBoolean,omitempty"`
+	DeceasedDateTime     string                 `json:"deceasedDateTime,omitempty"`
+	Address              []Address              `json:"address,omitempty"`
+	MaritalStatus        *CodeableConcept       `json:"maritalStatus,omitempty"`
+	MultipleBirthBoolean *bool                  `json:"multipleBirthBoolean,omitempty"`
+	MultipleBirthInteger *int                   `json:"multipleBirthInteger,omitempty"`
+	Photo                []Attachment           `json:"photo,omitempty"`
+	Contact              []PatientContact       `json:"contact,omitempty"`
+	Communication        []PatientCommunication `json:"communication,omitempty"`
+	GeneralPractitioner  []Reference            `json:"generalPractitioner,omitempty"`
+	ManagingOrganization *Reference             `json:"managingOrganization,omitempty"`
+	Link                 []PatientLink          `json:"link,omitempty"`
+}
+
+type PatientContact struct {
+	Element
+	Relationship []CodeableConcept `json:"relationship,omitempty"`
+	Name         *HumanName        `json:"name,omitempty"`
+	Telecom      []ContactPoint    `json:"telecom,omitempty"`
+	Address      *Address          `json:"address,omitempty"`
+	Gender       string            `json:"gender,omitempty"`
+	Organization *Reference        `json:"organization,omitempty"`
+	Period       *Period           `json:"period,omitempty"`
+}
+
+type PatientCommunication struct {
+	Element
+	Language  CodeableConcept `json:"language"`
+	Preferred *bool           `json:"preferred,omitempty"`
+}
+
+type PatientLink struct {
+	Element
+	Other Reference `json:"other"`
+	Type  string    `json:"type"`
+}
+
+type Encounter struct {
+	DomainResource
+	Identifier      []Identifier              `json:"identifier,omitempty"`
+	Status          string                    `json:"status"`
+	StatusHistory   []EncounterStatusHistory  `json:"statusHistory,omitempty"`
+	Class           Coding                    `json:"class"`
+	ClassHistory    []EncounterClassHistory   `json:"classHistory,omitempty"`
+	Type            []CodeableConcept         `json:"type,omitempty"`
+	ServiceType     *CodeableConcept          `json:"serviceType,omitempty"`
+	Priority        *CodeableConcept          `json:"priority,omitempty"`
+	Subject         *Reference                `json:"subject,omitempty"`
+	EpisodeOfCare   []Reference               `json:"episodeOfCare,omitempty"`
+	BasedOn         []Reference               `json:"basedOn,omitempty"`
+	Participant     []EncounterParticipant    `json:"participant,omitempty"`
+	Appointment     []Reference               `json:"appointment,omitempty"`
+	Period          *Period                   `json:"period,omitempty"`
+	Length          *Quantity                 `json:"length,omitempty"`
+	ReasonCode      []CodeableConcept         `json:"reasonCode,omitempty"`
+	ReasonReference []Reference               `json:"reasonReference,omitempty"`
+	Diagnosis       []EncounterDiagnosis      `json:"diagnosis,omitempty"`
+	Account         []Reference               `json:"account,omitempty"`
+	Hospitalization *EncounterHospitalization `json:"hospitalization,omitempty"`
+	Location        []EncounterLocation       `json:"location,omitempty"`
+	ServiceProvider *Reference                `json:"serviceProvider,omitempty"`
+	PartOf          *Reference                `json:"partOf,omitempty"`
+}
+
+type EncounterStatusHistory struct {
+	Element
+	Status string `json:"status"`
+	Period Period `json:"period"`
+}
+
+type EncounterClassHistory struct {
+	Element
+	Class  Coding `json:"class"`
+	Period Period `json:"period"`
+}
+
+type EncounterParticipant struct {
+	Element
+	Type       []CodeableConcept `json:"type,omitempty"`
+	Period     *Period           `json:"period,omitempty"`
+	Individual *Reference        `json:"individual,omitempty"`
+}
+
+type EncounterDiagnosis struct {
+	Element
+	Condition Reference        `json:"condition"`
+	Use       *CodeableConcept `json:"use,omitempty"`
+	Rank      *int             `json:"rank,omitempty"`
+}
+
+type EncounterHospitalization struct {
+	Element
+	PreAdmissionIdentifier *Identifier       `json:"preAdmissionIdentifier,omitempty"`
+	Origin                 *Reference        `json:"origin,omitempty"`
+	AdmitSource            *CodeableConcept  `json:"admitSource,omitempty"`
+	ReAdmission            *CodeableConcept  `json:"reAdmission,omitempty"`
+	DietPreference         []CodeableConcept `json:"dietPreference,omitempty"`
+	SpecialCourtesy        []CodeableConcept `json:"specialCourtesy,omitempty"`
+	SpecialArrangement     []CodeableConcept `json:"specialArrangement,omitempty"`
+	Destination            *Reference        `json:"destination,omitempty"`
+	DischargeDisposition   *CodeableConcept  `json:"dischargeDisposition,omitempty"`
+}
+
+type EncounterLocation struct {
+	Element
+	Location     Reference        `json:"location"`
+	Status       string           `json:"status,omitempty"`
+	PhysicalType *CodeableConcept `json:"physicalType,omitempty"`
+	Period       *Period          `json:"period,omitempty"`
+}
+
+type Condition struct {
+	DomainResource
+	Identifier         []Identifier        `json:"identifier,omitempty"`
+	ClinicalStatus     *CodeableConcept    `json:"clinicalStatus,omitempty"`
+	VerificationStatus *CodeableConcept    `json:"verificationStatus,omitempty"`
+	Category           []CodeableConcept   `json:"category,omitempty"`
+	Severity           *CodeableConcept    `json:"severity,omitempty"`
+	Code               *CodeableConcept    `json:"code,omitempty"`
+	BodySite           []CodeableConcept   `json:"bodySite,omitempty"`
+	Subject            Reference           `json:"subject"`
+	Encounter          *Reference          `json:"encounter,omitempty"`
+	OnsetDateTime      string              `json:"onsetDateTime,omitempty"`
+	OnsetAge           *Quantity           `json:"onsetAge,omitempty"`
+	OnsetPeriod        *Period             `json:"onsetPeriod,omitempty"`
+	OnsetRange         *Range              `json:"onsetRange,omitempty"`
+	OnsetString        string              `json:"onsetString,omitempty"`
+	AbatementDateTime  string              `json:"abatementDateTime,omitempty"`
+	AbatementAge       *Quantity           `json:"abatementAge,omitempty"`
+	AbatementPeriod    *Period             `json:"abatementPeriod,omitempty"`
+	AbatementRange     *Range              `json:"abatementRange,omitempty"`
+	AbatementString    string              `json:"abatementString,omitempty"`
+	RecordedDate       string              `json:"recordedDate,omitempty"`
+	Recorder           *Reference          `json:"recorder,omitempty"`
+	Asserter           *Reference          `json:"asserter,omitempty"`
+	Stage              []ConditionStage    `json:"stage,omitempty"`
+	Evidence           []ConditionEvidence `json:"evidence,omitempty"`
+	Note               []Annotation        `json:"note,omitempty"`
+}
+
+type ConditionStage struct {
+	Element
+	Summary    *CodeableConcept `json:"summary,omitempty"`
+	Assessment []Reference      `json:"assessment,omitempty"`
+	Type       *CodeableConcept `json:"type,omitempty"`
+}
+
+type ConditionEvidence struct {
+	Element
+	Code   []CodeableConcept `json:"code,omitempty"`
+	Detail []Reference       `json:"detail,omitempty"`
+}
+
+type Medication struct {
+	DomainResource
+	Identifier   []Identifier           `json:"identifier,omitempty"`
+	Code         *CodeableConcept       `json:"code,omitempty"`
+	Status       string                 `json:"status,omitempty"`
+	Manufacturer *Reference             `json:"manufacturer,omitempty"`
+	Form         *CodeableConcept       `json:"form,omitempty"`
+	Amount       *Ratio                 `json:"amount,omitempty"`
+	Ingredient   []MedicationIngredient `json:"ingredient,omitempty"`
+	Batch        *MedicationBatch       `json:"batch,omitempty"`
+}
+
+type MedicationIngredient struct {
+	Element
+	ItemCodeableConcept *CodeableConcept `json:"itemCodeableConcept,omitempty"`
+	ItemReference       *Reference       `json:"itemReference,omitempty"`
+	IsActive            *bool            `json:"isActive,omitempty"`
+	Strength            *Ratio           `json:"strength,omitempty"`
+}
+
+type MedicationBatch struct {
+	Element
+	LotNumber      string `json:"lotNumber,omitempty"`
+	ExpirationDate string `json:"expirationDate,omitempty"`
+}
+
+type MedicationRequest struct {
+	DomainResource
+	Identifier                []Identifier                      `json:"identifier,omitempty"`
+	Status                    string                            `json:"status"`
+	StatusReason              *CodeableConcept                  `json:"statusReason,omitempty"`
+	Intent                    string                            `json:"intent"`
+	Category                  []CodeableConcept                 `json:"category,omitempty"`
+	Priority                  string                            `json:"priority,omitempty"`
+	DoNotPerform              *bool                             `json:"doNotPerform,omitempty"`
+	ReportedBoolean           *bool                             `json:"reportedBoolean,omitempty"`
+	ReportedReference         *Reference                        `json:"reportedReference,omitempty"`
+	MedicationCodeableConcept *CodeableConcept                  `json:"medicationCodeableConcept,omitempty"`
+	MedicationReference       *Reference                        `json:"medicationReference,omitempty"`
+	Subject                   Reference                         `json:"subject"`
+	Encounter                 *Reference                        `json:"encounter,omitempty"`
+	SupportingInformation     []Reference                       `json:"supportingInformation,omitempty"`
+	AuthoredOn                string                            `json:"authoredOn,omitempty"`
+	Requester                 *Reference                        `json:"requester,omitempty"`
+	Performer                 *Reference                        `json:"performer,omitempty"`
+	PerformerType             *CodeableConcept                  `json:"performerType,omitempty"`
+	Recorder                  *Reference                        `json:"recorder,omitempty"`
+	ReasonCode                []CodeableConcept                 `json:"reasonCode,omitempty"`
+	ReasonReference           []Reference                       `json:"reasonReference,omitempty"`
+	InstantiatesCanonical     []string                          `json:"instantiatesCanonical,omitempty"`
+	InstantiatesURI           []string                          `json:"instantiatesUri,omitempty"`
+	BasedOn                   []Reference                       `json:"basedOn,omitempty"`
+	GroupIdentifier           *Identifier                       `json:"groupIdentifier,omitempty"`
+	CourseOfTherapyType       *CodeableConcept                  `json:"courseOfTherapyType,omitempty"`
+	Insurance                 []Reference                       `json:"insurance,omitempty"`
+	Note                      []Annotation                      `json:"note,omitempty"`
+	DosageInstruction         []Dosage                          `json:"dosageInstruction,omitempty"`
+	DispenseRequest           *MedicationRequestDispenseRequest `json:"dispenseRequest,omitempty"`
+	Substitution              *MedicationRequestSubstitution    `json:"substitution,omitempty"`
+	PriorPrescription         *Reference                        `json:"priorPrescription,omitempty"`
+	DetectedIssue             []Reference                       `json:"detectedIssue,omitempty"`
+	EventHistory              []Reference                       `json:"eventHistory,omitempty"`
+}
+
+type MedicationRequestDispenseRequest struct {
+	Element
+	InitialFill *struct {
+		Element
+		Quantity *Quantity `json:"quantity,omitempty"`
+		Duration *Quantity `json:"duration,omitempty"`
+	} `json:"initialFill,omitempty"`
+	DispenseInterval       *Quantity  `json:"dispenseInterval,omitempty"`
+	ValidityPeriod         *Period    `json:"validityPeriod,omitempty"`
+	NumberOfRepeatsAllowed *int       `json:"numberOfRepeatsAllowed,omitempty"`
+	Quantity               *Quantity  `json:"quantity,omitempty"`
+	ExpectedSupplyDuration *Quantity  `json:"expectedSupplyDuration,omitempty"`
+	Performer              *Reference `json:"performer,omitempty"`
+}
+
+type MedicationRequestSubstitution struct {
+	Element
+	AllowedBoolean         *bool            `json:"allowedBoolean,omitempty"`
+	AllowedCodeableConcept *CodeableConcept `json:"allowedCodeableConcept,omitempty"`
+	Reason                 *CodeableConcept `json:"reason,omitempty"`
+}
+
+type MedicationDispense struct {
+	DomainResource
+	Identifier                  []Identifier                    `json:"identifier,omitempty"`
+	PartOf                      []Reference                     `json:"partOf,omitempty"`
+	Status                      string                          `json:"status"`
+	StatusReasonCodeableConcept *CodeableConcept                `json:"statusReasonCodeableConcept,omitempty"`
+	StatusReasonReference       *Reference                      `json:"statusReasonReference,omitempty"`
+	Category                    *CodeableConcept                `json:"category,omitempty"`
+	MedicationCodeableConcept   *CodeableConcept                `json:"medicationCodeableConcept,omitempty"`
+	MedicationReference         *Reference                      `json:"medicationReference,omitempty"`
+	Subject                     *Reference                      `json:"subject,omitempty"`
+	Context                     *Reference                      `json:"context,omitempty"`
+	SupportingInformation       []Reference                     `json:"supportingInformation,omitempty"`
+	Performer                   []MedicationDispensePerformer   `json:"performer,omitempty"`
+	Location                    *Reference                      `json:"location,omitempty"`
+	AuthorizingPrescription     []Reference                     `json:"authorizingPrescription,omitempty"`
+	Type                        *CodeableConcept                `json:"type,omitempty"`
+	Quantity                    *Quantity                       `json:"quantity,omitempty"`
+	DaysSupply                  *Quantity                       `json:"daysSupply,omitempty"`
+	WhenPrepared                string                          `json:"whenPrepared,omitempty"`
+	WhenHandedOver              string                          `json:"whenHandedOver,omitempty"`
+	Destination                 *Reference                      `json:"destination,omitempty"`
+	Receiver                    []Reference                     `json:"receiver,omitempty"`
+	Note                        []Annotation                    `json:"note,omitempty"`
+	DosageInstruction           []Dosage                        `json:"dosageInstruction,omitempty"`
+	Substitution                *MedicationDispenseSubstitution `json:"substitution,omitempty"`
+	DetectedIssue               []Reference                     `json:"detectedIssue,omitempty"`
+	EventHistory                []Reference                     `json:"eventHistory,omitempty"`
+}
+
+type MedicationDispensePerformer struct {
+	Element
+	Function *CodeableConcept `json:"function,omitempty"`
+	Actor    Reference        `json:"actor"`
+}
+
+type MedicationDispenseSubstitution struct {
+	Element
+	WasSubstituted   bool              `json:"wasSubstituted"`
+	Type             *CodeableConcept  `json:"type,omitempty"`
+	Reason           []CodeableConcept `json:"reason,omitempty"`
+	ResponsibleParty []Reference       `json:"responsibleParty,omitempty"`
+}
+
+// Observation.value[x], shared by observations and their components
+type ObservationValue struct {
+	ValueQuantity        *Quantity        `json:"valueQuantity,omitempty"`
+	ValueCodeableConcept *CodeableConcept `json:"valueCodeableConcept,omitempty"`
+	ValueString          string           `json:"valueString,omitempty"`
+	ValueBoolean         *bool            `json:"valueBoolean,omitempty"`
+	ValueInteger         *int             `json:"valueInteger,omitempty"`
+	ValueRange           *Range           `json:"valueRange,omitempty"`
+	ValueRatio           *Ratio           `json:"valueRatio,omitempty"`
+	ValueSampledData     *SampledData     `json:"valueSampledData,omitempty"`
+	ValueTime            string           `json:"valueTime,omitempty"`
+	ValueDateTime        string           `json:"valueDateTime,omitempty"`
+	ValuePeriod          *Period          `json:"valuePeriod,omitempty"`
+}
+
+type Observation struct {
+	DomainResource
+	Identifier        []Identifier      `json:"identifier,omitempty"`
+	BasedOn           []Reference       `json:"basedOn,omitempty"`
+	PartOf            []Reference       `json:"partOf,omitempty"`
+	Status            string            `json:"status"`
+	Category          []CodeableConcept `json:"category,omitempty"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           *Reference        `json:"subject,omitempty"`
+	Focus             []Reference       `json:"focus,omitempty"`
+	Encounter         *Reference        `json:"encounter,omitempty"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	EffectivePeriod   *Period           `json:"effectivePeriod,omitempty"`
+	EffectiveTiming   *Timing           `json:"effectiveTiming,omitempty"`
+	EffectiveInstant  string            `json:"effectiveInstant,omitempty"`
+	Issued            string            `json:"issued,omitempty"`
+	Performer         []Reference       `json:"performer,omitempty"`
+	ObservationValue
+	DataAbsentReason *CodeableConcept            `json:"dataAbsentReason,omitempty"`
+	Interpretation   []CodeableConcept           `json:"interpretation,omitempty"`
+	Note             []Annotation                `json:"note,omitempty"`
+	BodySite         *CodeableConcept            `json:"bodySite,omitempty"`
+	Method           *CodeableConcept            `json:"method,omitempty"`
+	Specimen         *Reference                  `json:"specimen,omitempty"`
+	Device           *Reference                  `json:"device,omitempty"`
+	ReferenceRange   []ObservationReferenceRange `json:"referenceRange,omitempty"`
+	HasMember        []Reference                 `json:"hasMember,omitempty"`
+	DerivedFrom      []Reference                 `json:"derivedFrom,omitempty"`
+	Component        []ObservationComponent      `json:"component,omitempty"`
+}
+
+type ObservationReferenceRange struct {
+	Element
+	Low       *Quantity         `json:"low,omitempty"`
+	High      *Quantity         `json:"high,omitempty"`
+	Type      *CodeableConcept  `json:"type,omitempty"`
+	AppliesTo []CodeableConcept `json:"appliesTo,omitempty"`
+	Age       *Range            `json:"age,omitempty"`
+	Text      string            `json:"text,omitempty"`
+}
+
+type ObservationComponent struct {
+	Element
+	Code CodeableConcept `json:"code"`
+	ObservationValue
+	DataAbsentReason *CodeableConcept            `json:"dataAbsentReason,omitempty"`
+	Interpretation   []CodeableConcept           `json:"interpretation,omitempty"`
+	ReferenceRange   []ObservationReferenceRange `json:"referenceRange,omitempty"`
+}
+
+type AllergyIntolerance struct {
+	DomainResource
+	Identifier         []Identifier                 `json:"identifier,omitempty"`
+	ClinicalStatus     *CodeableConcept             `json:"clinicalStatus,omitempty"`
+	VerificationStatus *CodeableConcept             `json:"verificationStatus,omitempty"`
+	Type               string                       `json:"type,omitempty"`
+	Category           []string                     `json:"category,omitempty"`
+	Criticality        string                       `json:"criticality,omitempty"`
+	Code               *CodeableConcept             `json:"code,omitempty"`
+	Patient            Reference                    `json:"patient"`
+	Encounter          *Reference                   `json:"encounter,omitempty"`
+	OnsetDateTime      string                       `json:"onsetDateTime,omitempty"`
+	OnsetAge           *Quantity                    `json:"onsetAge,omitempty"`
+	OnsetPeriod        *Period                      `json:"onsetPeriod,omitempty"`
+	OnsetRange         *Range                       `json:"onsetRange,omitempty"`
+	OnsetString        string                       `json:"onsetString,omitempty"`
+	RecordedDate       string                       `json:"recordedDate,omitempty"`
+	Recorder           *Reference                   `json:"recorder,omitempty"`
+	Asserter           *Reference                   `json:"asserter,omitempty"`
+	LastOccurrence     string                       `json:"lastOccurrence,omitempty"`
+	Note               []Annotation                 `json:"note,omitempty"`
+	Reaction           []AllergyIntoleranceReaction `json:"reaction,omitempty"`
+}
+
+type AllergyIntoleranceReaction struct {
+	Element
+	Substance     *CodeableConcept  `json:"substance,omitempty"`
+	Manifestation []CodeableConcept `json:"manifestation"`
+	Description   string            `json:"description,omitempty"`
+	Onset         string            `json:"onset,omitempty"`
+	Severity      string            `json:"severity,omitempty"`
+	ExposureRoute *CodeableConcept  `json:"exposureRoute,omitempty"`
+	Note          []Annotation      `json:"note,omitempty"`
+}
+
+type CareTeam struct {
+	DomainResource
+	Identifier           []Identifier          `json:"identifier,omitempty"`
+	Status               string                `json:"status,omitempty"`
+	Category             []CodeableConcept     `json:"category,omitempty"`
+	Name                 string                `json:"name,omitempty"`
+	Subject              *Reference            `json:"subject,omitempty"`
+	Encounter            *Reference            `json:"encounter,omitempty"`
+	Period               *Period               `json:"period,omitempty"`
+	Participant          []CareTeamParticipant `json:"participant,omitempty"`
+	ReasonCode           []CodeableConcept     `json:"reasonCode,omitempty"`
+	ReasonReference      []Reference           `json:"reasonReference,omitempty"`
+	ManagingOrganization []Reference           `json:"managingOrganization,omitempty"`
+	Telecom              []ContactPoint        `json:"telecom,omitempty"`
+	Note                 []Annotation          `json:"note,omitempty"`
+}
+
+type CareTeamParticipant struct {
+	Element
+	Role       []CodeableConcept `json:"role,omitempty"`
+	Member     *Reference        `json:"member,omitempty"`
+	OnBehalfOf *Reference        `json:"onBehalfOf,omitempty"`
+	Period     *Period           `json:"period,omitempty"`
+}
+
+type List struct {
+	DomainResource
+	Identifier  []Identifier     `json:"identifier,omitempty"`
+	Status      string           `json:"status"`
+	Mode        string           `json:"mode"`
+	Title       string           `json:"title,omitempty"`
+	Code        *CodeableConcept `json:"code,omitempty"`
+	Subject     *Reference       `json:"subject,omitempty"`
+	Encounter   *Reference       `json:"encounter,omitempty"`
+	Date        string           `json:"date,omitempty"`
+	Source      *Reference       `json:"source,omitempty"`
+	OrderedBy   *CodeableConcept `json:"orderedBy,omitempty"`
+	Note        []Annotation     `json:"note,omitempty"`
+	Entry       []ListEntry      `json:"entry,omitempty"`
+	EmptyReason *CodeableConcept `json:"emptyReason,omitempty"`
+}
+
+type ListEntry struct {
+	Element
+	Flag    *CodeableConcept `json:"flag,omitempty"`
+	Deleted *bool            `json:"deleted,omitempty"`
+	Date    string           `json:"date,omitempty"`
+	Item    Reference        `json:"item"`
+}
+
+type Appointment struct {
+	DomainResource
+	Identifier            []Identifier             `json:"identifier,omitempty"`
+	Status                string                   `json:"status"`
+	CancelationReason     *CodeableConcept         `json:"cancelationReason,omitempty"`
+	ServiceCategory       []CodeableConcept        `json:"serviceCategory,omitempty"`
+	ServiceType           []CodeableConcept        `json:"serviceType,omitempty"`
+	Specialty             []CodeableConcept        `json:"specialty,omitempty"`
+	AppointmentType       *CodeableConcept         `json:"appointmentType,omitempty"`
+	ReasonCode            []CodeableConcept        `json:"reasonCode,omitempty"`
+	ReasonReference       []Reference              `json:"reasonReference,omitempty"`
+	Priority              *int                     `json:"priority,omitempty"`
+	Description           string                   `json:"description,omitempty"`
+	SupportingInformation []Reference              `json:"supportingInformation,omitempty"`
+	Start                 string                   `json:"start,omitempty"`
+	End                   string                   `json:"end,omitempty"`
+	MinutesDuration       *int                     `json:"minutesDuration,omitempty"`
+	Slot                  []Reference              `json:"slot,omitempty"`
+	Created               string                   `json:"created,omitempty"`
+	Comment               string                   `json:"comment,omitempty"`
+	PatientInstruction    string                   `json:"patientInstruction,omitempty"`
+	BasedOn               []Reference              `json:"basedOn,omitempty"`
+	Participant           []AppointmentParticipant `json:"participant"`
+	RequestedPeriod       []Period                 `json:"requestedPeriod,omitempty"`
+}
+
+type AppointmentParticipant struct {
+	Element
+	Type     []CodeableConcept `json:"type,omitempty"`
+	Actor    *Reference        `json:"actor,omitempty"`
+	Required string            `json:"required,omitempty"`
+	Status   string            `json:"status"`
+	Period   *Period           `json:"period,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string          `json:"resourceType"`
+	Id           string          `json:"id,omitempty"`
+	Meta         *Meta           `json:"meta,omitempty"`
+	Identifier   *Identifier     `json:"identifier,omitempty"`
+	Type         string          `json:"type"`
+	Timestamp    string          `json:"timestamp,omitempty"`
+	Total        *int            `json:"total,omitempty"`
+	Link         []BundleLink    `json:"link,omitempty"`
+	Entry        []BundleEntry   `json:"entry,omitempty"`
+	Signature    json.RawMessage `json:"signature,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type BundleLink struct {
+	Element
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	Element
+	Link     []BundleLink         `json:"link,omitempty"`
+	FullURL  string               `json:"fullUrl,omitempty"`
+	Resource *RawResource         `json:"resource,omitempty"`
+	Search   *BundleEntrySearch   `json:"search,omitempty"`
+	Request  *BundleEntryRequest  `json:"request,omitempty"`
+	Response *BundleEntryResponse `json:"response,omitempty"`
+}
+
+type BundleEntrySearch struct {
+	Element
+	Mode  string      `json:"mode,omitempty"`
+	Score json.Number `json:"score,omitempty"`
+}
+
+type BundleEntryRequest struct {
+	Element
+	Method          string `json:"method"`
+	URL             string `json:"url"`
+	IfNoneMatch     string `json:"ifNoneMatch,omitempty"`
+	IfModifiedSince string `json:"ifModifiedSince,omitempty"`
+	IfMatch         string `json:"ifMatch,omitempty"`
+	IfNoneExist     string `json:"ifNoneExist,omitempty"`
+}
+
+type BundleEntryResponse struct {
+	Element
+	Status       string       `json:"status"`
+	Location     string       `json:"location,omitempty"`
+	Etag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"lastModified,omitempty"`
+	Outcome      *RawResource `json:"outcome,omitempty"`
+}
+
+// Keep unmodeled elements of each resource through a round trip
+
+func (r *Patient) UnmarshalJSON(data []byte) error {
+	type patient Patient
+	return unmarshalResource(data, (*patient)(r), &r.Extra)
+}
+
+func (r Patient) MarshalJSON() ([]byte, error) {
+	type patient Patient
+	return marshalResource(patient(r), r.Extra)
+}
+
+func (r *Encounter) UnmarshalJSON(data []byte) error {
+	type encounter Encounter
+	return unmarshalResource(data, (*encounter)(r), &r.Extra)
+}
+
+func (r Encounter) MarshalJSON() ([]byte, error) {
+	type encounter Encounter
+	return marshalResource(encounter(r), r.Extra)
+}
+
+func (r *Condition) UnmarshalJSON(data []byte) error {
+	type condition Condition
+	return unmarshalResource(data, (*condition)(r), &r.Extra)
+}
+
+func (r Condition) MarshalJSON() ([]byte, error) {
+	type condition Condition
+	return marshalResource(condition(r), r.Extra)
+}
+
+func (r *Medication) UnmarshalJSON(data []byte) error {
+	type medication Medication
+	return unmarshalResource(data, (*medication)(r), &r.Extra)
+}
+
+func (r Medication) MarshalJSON() ([]byte, error) {
+	type medication Medication
+	return marshalResource(medication(r), r.Extra)
+}
+
+func (r *MedicationRequest) UnmarshalJSON(data []byte) error {
+	type medicationRequest MedicationRequest
+	return unmarshalResource(data, (*medicationRequest)(r), &r.Extra)
+}
+
+func (r MedicationRequest) MarshalJSON() ([]byte, error) {
+	type medicationRequest MedicationRequest
+	return marshalResource(medicationRequest(r), r.Extra)
+}
+
+func (r *MedicationDispense) UnmarshalJSON(data []byte) error {
+	type medicationDispense MedicationDispense
+	return unmarshalResource(data, (*medicationDispense)(r), &r.Extra)
+}
+
+func (r MedicationDispense) MarshalJSON() ([]byte, error) {
+	type medicationDispense MedicationDispense
+	return marshalResource(medicationDispense(r), r.Extra)
+}
+
+func (r *Observation) UnmarshalJSON(data []byte) error {
+	type observation Observation
+	return unmarshalResource(data, (*observation)(r), &r.Extra)
+}
+
+func (r Observation) MarshalJSON() ([]byte, error) {
+	type observation Observation
+	return marshalResource(observation(r), r.Extra)
+}
+
+func (r *AllergyIntolerance) UnmarshalJSON(data []byte) error {
+	type allergyIntolerance AllergyIntolerance
+	return unmarshalResource(data, (*allergyIntolerance)(r), &r.Extra)
+}
+
+func (r AllergyIntolerance) MarshalJSON() ([]byte, error) {
+	type allergyIntolerance AllergyIntolerance
+	return marshalResource(allergyIntolerance(r), r.Extra)
+}
+
+func (r *CareTeam) UnmarshalJSON(data []byte) error {
+	type careTeam CareTeam
+	return unmarshalResource(data, (*careTeam)(r), &r.Extra)
+}
+
+func (r CareTeam) MarshalJSON() ([]byte, error) {
+	type careTeam CareTeam
+	return marshalResource(careTeam(r), r.Extra)
+}
+
+func (r *List) UnmarshalJSON(data []byte) error {
+	type list List
+	return unmarshalResource(data, (*list)(r), &r.Extra)
+}
+
+func (r List) MarshalJSON() ([]byte, error) {
+	type list List
+	return marshalResource(list(r), r.Extra)
+}
+
+func (r *Appointment) UnmarshalJSON(data []byte) error {
+	type appointment Appointment
+	return unmarshalResource(data, (*appointment)(r), &r.Extra)
+}
+
+func (r Appointment) MarshalJSON() ([]byte, error) {
+	type appointment Appointment
+	return marshalResource(appointment(r), r.Extra)
+}
+
+func (r *Bundle) UnmarshalJSON(data []byte) error {
+	type bundle Bundle
+	return unmarshalResource(data, (*bundle)(r), &r.Extra)
+}
+
+func (r Bundle) MarshalJSON() ([]byte, error) {
+	type bundle Bundle
+	return marshalResource(bundle(r), r.Extra)
+}
@@ -10,27 +10,51 @@ var (
 	appVersion string
 )
 
+// CDS Hooks services offered by this service
+var services = []Service{
+	{
+		Hook:        "patient-view",
+		Title:       "Check SMART Asthma Eligibility",
+		Description: "Checks if a patient is eligible for SMART asthma therapy",
+		Id:          "eligibility",
+		Prefetch: map[string]string{
+			"encounter":   "Encounter?patient={{context.patientId}}",
+			"medications": "MedicationRequest?patient={{context.patientId}}",
+		},
+	},
+	{
+		Hook:        "order-select",
+		Title:       "Suggest SMART Asthma Therapy",
+		Description: "Suggests ICS-formoterol SMART when a separate ICS and SABA are ordered for an eligible patient",
+		Id:          "order-select",
+	},
+	{
+		Hook:        "order-sign",
+		Title:       "Check SMART Asthma Orders",
+		Description: "Warns when a SMART order is signed without a combined maintenance and reliever sig",
+		Id:          "order-sign",
+	},
+}
+
 func cdsServices(c echo.Context) error {
 	// Build basic Hook response
 	serviceResponse := ServiceResponse{
-		Services: []Service{
-			{
-				Hook:        "patient-view",
-				Title:       "Check SMART Asthma Eligibility",
-				Description: "Checks if a patient is eligible for SMART asthma therapy",
-				Id:          "eligibility",
-				Prefetch: map[string]string{
-					"encounter":   "Encounter?patient={{context.patientId}}",
-					"medications": "MedicationRequest?patient={{context.patientId}}",
-				},
-			},
-		},
+		Services: services,
 	}
 
 	// Return response
 	return c.JSON(http.StatusOK, serviceResponse)
 }
 
+// Returns the IDs of the CDS Hooks services
+func serviceIds() []string {
+	var ids []string
+	for _, service := range services {
+		ids = append(ids, service.Id)
+	}
+	return ids
+}
+
 func heartbeat(c echo.Context) error {
 	// Heartbeat function to assess service status. Immediately return 200
 	return c.NoContent(http.StatusOK)
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// Seconds to wait for each dependency when checking readiness
+	readyTimeout int = getEnvInt("READY_TIMEOUT", 2)
+
+	// Also check each tenant's FHIR server, with a metadata request
+	readyFHIRMetadata bool = getEnv("READY_FHIR_METADATA", "false") == "true"
+)
+
+const (
+	checkOK      string = "ok"
+	checkFail    string = "fail"
+	checkSkipped string = "skipped"
+)
+
+// Result of checking a dependency. Only critical checks affect readiness; the rest are reported
+// for the status page.
+type HealthCheck struct {
+	Status   string         `json:"status"`
+	Critical bool           `json:"critical"`
+	Error    string         `json:"error,omitempty"`
+	Latency  float64        `json:"latencySeconds,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+type Readiness struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version,omitempty"`
+	Checks  map[string]HealthCheck `json:"checks"`
+}
+
+// Liveness probe. The process is alive if it can respond.
+func livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// Readiness probe. Returns 503 if a critical check fails, with the result of every check.
+func readyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Duration(readyTimeout)*time.Second)
+	defer cancel()
+
+	readiness := checkReadiness(ctx)
+	status := http.StatusOK
+	if readiness.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, readiness)
+}
+
+// Runs every readiness check concurrently
+func checkReadiness(ctx context.Context) Readiness {
+	checks := map[string]func(context.Context) HealthCheck{
+		"shutdown":     checkShutdown,
+		"config":       checkConfig,
+		"configReload": checkConfigReload,
+		"valueSets":    checkValueSets,
+		"authService":  checkAuthService,
+		"elk":          checkElk,
+	}
+	if readyFHIRMetadata && currentTenants() != nil {
+		for name, config := range currentTenants().Tenants {
+			checks["fhir:"+name] = func(ctx context.Context) HealthCheck {
+				return checkFHIRMetadata(ctx, config)
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	readiness := Readiness{Status: "ready", Version: appVersion, Checks: map[string]HealthCheck{}}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			result := check(ctx)
+			if result.Status != checkSkipped {
+				result.Latency = time.Since(start).Seconds()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			readiness.Checks[name] = result
+			if result.Critical && result.Status == checkFail {
+				readiness.Status = "not ready"
+			}
+		}()
+	}
+	wg.Wait()
+
+	return readiness
+}
+
+// Instances that are shutting down stop taking traffic
+func checkShutdown(ctx context.Context) HealthCheck {
+	if hooks.Draining() {
+		return HealthCheck{Status: checkFail, Critical: true, Error: "shutting down"}
+	}
+	return HealthCheck{Status: checkOK, Critical: true}
+}
+
+// A valid configuration has been loaded
+func checkConfig(ctx context.Context) HealthCheck {
+	registry := currentTenants()
+	if registry == nil || len(registry.Tenants) == 0 {
+		return HealthCheck{Status: checkFail, Critical: true, Error: "no valid configuration loaded"}
+	}
+
+	tenants := make([]string, 0, len(registry.Tenants))
+	for name := range registry.Tenants {
+		tenants = append(tenants, name)
+	}
+	sort.Strings(tenants)
+	return HealthCheck{Status: checkOK, Critical: true, Details: map[string]any{"tenants": tenants}}
+}
+
+// The last reload succeeded. A failed reload keeps the previous configuration, so it is not critical.
+func checkConfigReload(ctx context.Context) HealthCheck {
+	if err := reloadErr.Load(); err != nil {
+		return HealthCheck{Status: checkFail, Error: fmt.Sprintf("serving previous config: %v", *err)}
+	}
+	return HealthCheck{Status: checkOK}
+}
+
+// Every tenant has the value sets the criteria depend on. An unset value set matches every code.
+func checkValueSets(ctx context.Context) HealthCheck {
+	registry := currentTenants()
+	if registry == nil {
+		return HealthCheck{Status: checkFail, Critical: true, Error: "no valid configuration loaded"}
+	}
+
+	var missing []string
+	for name, config := range registry.Tenants {
+		if config.Codes == nil {
+			missing = append(missing, name+": value sets not compiled")
+			continue
+		}
+		required := map[string]string{
+			"asthmaICD":           config.Codes.AsthmaICD.String(),
+			"encounterTypeSystem": config.Codes.EncounterTypeSystem.String(),
+			"csnSystem":           config.Codes.CSNSystem.String(),
+			"antiAsthmatic":       config.Codes.AntiAsthmatic.String(),
+			"biologic":            config.Codes.Biologic.String(),
+			"controller":          config.Codes.Controller.String(),
+			"icsf":                config.Codes.ICSF.String(),
+			"steroid":             config.Codes.Steroid.String(),
+		}
+		for field, expr := range required {
+			if expr == "" {
+				missing = append(missing, fmt.Sprintf("%s: valueSets.%s is not set", name, field))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return HealthCheck{Status: checkFail, Critical: true, Error: strings.Join(missing, "; ")}
+	}
+	return HealthCheck{Status: checkOK, Critical: true}
+}
+
+// The auth service that verifies hook tokens is reachable
+func checkAuthService(ctx context.Context) HealthCheck {
+	if authHost == "" {
+		return HealthCheck{Status: checkFail, Critical: true, Error: "AUTH_HOST is not set"}
+	}
+	if err := checkReachable(ctx, authHost, nil, false); err != nil {
+		return HealthCheck{Status: checkFail, Critical: true, Error: err.Error()}
+	}
+	return HealthCheck{Status: checkOK, Critical: true}
+}
+
+// Elasticsearch is reachable. Events are queued and spilled while it is not, so it is not critical.
+func checkElk(ctx context.Context) HealthCheck {
+	if elkUrl == "" {
+		return HealthCheck{Status: checkSkipped}
+	}
+
+	stats := elkShip.Stats()
+	details := map[string]any{
+		"queued":  stats.Queued,
+		"sent":    stats.Sent,
+		"spilled": stats.Spilled,
+		"dropped": stats.Dropped,
+		"failed":  stats.Failed,
+	}
+	if err := checkReachable(ctx, strings.TrimSuffix(elkShip.url, "/_bulk"), nil, false); err != nil {
+		return HealthCheck{Status: checkFail, Error: err.Error(), Details: details}
+	}
+	return HealthCheck{Status: checkOK, Details: details}
+}
+
+// The tenant's FHIR server returns its CapabilityStatement. Other tenants are unaffected by an
+// outage, so it is not critical.
+func checkFHIRMetadata(ctx context.Context, config *Config) HealthCheck {
+	if len(config.FHIRServers) == 0 {
+		return HealthCheck{Status: checkSkipped}
+	}
+
+	headers := map[string]string{"Accept": "application/fhir+json"}
+	url := strings.TrimRight(config.FHIRServers[0], "/") + "/metadata"
+	if err := checkReachable(ctx, url, headers, true); err != nil {
+		return HealthCheck{Status: checkFail, Error: err.Error()}
+	}
+	return HealthCheck{Status: checkOK}
+}
+
+// Sends a GET request. Services that reject unauthenticated requests are reachable if they
+// respond without a server error; others must respond with 200.
+func checkReachable(ctx context.Context, url string, headers map[string]string, requireOK bool) error {
+	resp, err := sendRequest(ctx, "GET", url, nil, headers, nil, readyTimeout)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 || (requireOK && resp.StatusCode != http.StatusOK) {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
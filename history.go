@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Hours between removing evaluations older than each tenant's retention
+	historyPruneInterval int = getEnvInt("HISTORY_PRUNE_INTERVAL", 1)
+)
+
+const (
+	// Days evaluations are kept when a tenant does not set a retention
+	defaultHistoryRetention int = 730
+
+	// Sortable timestamp used in history keys
+	historyTimeFormat string = "20060102T150405.000000000Z"
+)
+
+// Snapshot of an evaluation, keyed by tenant, patient and time evaluated
+type EvaluationRecord struct {
+	Tenant            string                  `json:"tenant"`
+	CriteriaVersion   string                  `json:"criteriaVersion"`
+	Service           string                  `json:"service"`
+	PatientId         string                  `json:"patientId"`
+	EncounterId       string                  `json:"encounterId,omitempty"`
+	Evaluated         time.Time               `json:"evaluated"`
+	Outcome           string                  `json:"outcome"`
+	AsthmaRegistry    *AsthmaRegistryCriteria `json:"asthmaRegistry,omitempty"`
+	SmartEligible     *SmartEligibleCriteria  `json:"smartEligible,omitempty"`
+	SmartInitiated    *SmartInitiatedCriteria `json:"smartInitiated,omitempty"`
+	Control           *ControlAssessment      `json:"control,omitempty"`
+	Adherence         *Adherence              `json:"adherence,omitempty"`
+	Contraindications []string                `json:"contraindications,omitempty"`
+	Suppression       string                  `json:"suppression,omitempty"`
+	Evidence          map[string][]string     `json:"evidence,omitempty"`
+	CardShown         bool                    `json:"cardShown"`
+	CardUUID          string                  `json:"cardUUID,omitempty"`
+	Writeback         string                  `json:"writeback,omitempty"`
+}
+
+// A patient's evaluations, with when they first became eligible for SMART and whether SMART was
+// initiated afterwards
+type PatientHistory struct {
+	Tenant         string             `json:"tenant"`
+	PatientId      string             `json:"patientId"`
+	FirstEligible  *time.Time         `json:"firstEligible,omitempty"`
+	FirstInitiated *time.Time         `json:"firstInitiated,omitempty"`
+	Initiated      bool               `json:"initiatedAfterEligible"`
+	Evaluations    []EvaluationRecord `json:"evaluations"`
+}
+
+// Returns the key prefix of a patient's evaluations
+func historyPrefix(tenant, patientId string) string {
+	return tenant + "|" + patientId + "|"
+}
+
+// Returns the days a tenant's evaluations are kept
+func (h *HistoryConfig) retention() int {
+	if h == nil || h.RetentionDays <= 0 {
+		return defaultHistoryRetention
+	}
+	return h.RetentionDays
+}
+
+// Takes a snapshot of the evaluation. The outcome, card and writeback are filled in as the
+// response is built.
+func (er *EligibilityRequest) snapshot(service string) *EvaluationRecord {
+	record := &EvaluationRecord{
+		Tenant:          er.Config.Name,
+		CriteriaVersion: er.Config.criteriaVersion(),
+		Service:         service,
+		PatientId:       er.Context.Patient.Id,
+		EncounterId:     er.Context.Encounter["id"],
+		Evaluated:       time.Now().UTC(),
+		AsthmaRegistry:  er.Criteria.AsthmaRegistry,
+		SmartEligible:   er.Criteria.SmartEligible,
+		SmartInitiated:  er.Criteria.SmartInitiated,
+		Control:         er.Criteria.Control,
+		Adherence:       er.Criteria.Adherence,
+		Suppression:     er.Suppression,
+		Evidence:        er.evidenceIds(),
+	}
+	for _, ci := range er.Criteria.Contraindications {
+		record.Contraindications = append(record.Contraindications, ci.Rule)
+	}
+	return record
+}
+
+// Returns the IDs of the resources behind the criteria, by kind
+func (er *EligibilityRequest) evidenceIds() map[string][]string {
+	evidence := map[string][]string{}
+	add := func(kind, id string) {
+		if id != "" {
+			evidence[kind] = append(evidence[kind], id)
+		}
+	}
+
+	for _, mr := range er.Data.ControllerMedicationRequests {
+		add("controller", mr.Id)
+	}
+	for _, mr := range er.Data.BiologicMedicationRequests {
+		add("biologic", mr.Id)
+	}
+	for _, mr := range er.Data.SteroidMedicationRequests {
+		add("steroid", mr.Id)
+	}
+	for _, e := range er.Data.Exacerbations {
+		for _, encounter := range e.Encounters {
+			add("exacerbationEncounter", encounter.Id)
+		}
+	}
+	for _, o := range er.Data.AsthmaControlTool.Observations {
+		add("asthmaControlTool", o.Id)
+	}
+	for _, o := range append(er.Data.AsthmaActionPlan.GreenZone, er.Data.AsthmaActionPlan.YellowZone...) {
+		add("asthmaActionPlan", o.Id)
+	}
+	for _, condition := range er.Data.ProblemList {
+		for _, code := range condition.Code.Coding {
+			if er.Config.Codes.AsthmaICD.MatchString(code.Code) {
+				add("asthmaProblem", condition.Id)
+				break
+			}
+		}
+	}
+
+	if len(evidence) == 0 {
+		return nil
+	}
+	return evidence
+}
+
+// Stores an evaluation, if the tenant keeps history, trimming the patient's oldest evaluations
+// beyond the tenant's limit. Errors are logged and do not affect the response.
+func (er *EligibilityRequest) recordEvaluation(record *EvaluationRecord) {
+	h := er.Config.History
+	if h == nil {
+		return
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("failed to record evaluation: %v (patient: %s)", err, record.PatientId))
+		return
+	}
+
+	prefix := historyPrefix(record.Tenant, record.PatientId)
+	err = store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyBucket))
+		if err := bucket.Put([]byte(prefix+record.Evaluated.Format(historyTimeFormat)), data); err != nil {
+			return err
+		}
+		if h.MaxPerPatient <= 0 {
+			return nil
+		}
+
+		// Keys sort by time, so the oldest come first
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		for len(keys) > h.MaxPerPatient {
+			if err := bucket.Delete(keys[0]); err != nil {
+				return err
+			}
+			keys = keys[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("failed to record evaluation: %v (patient: %s)", err, record.PatientId))
+	}
+}
+
+// Removes evaluations older than their tenant's retention. Tenants no longer configured use the
+// default retention.
+func pruneHistory() error {
+	tenants := map[string]*Config{}
+	if registry := currentTenants(); registry != nil {
+		tenants = registry.Tenants
+	}
+
+	now := time.Now()
+	var removed int
+	err := store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyBucket))
+
+		// Collect expired keys first, as deleting while iterating skips keys
+		var expired [][]byte
+		err := bucket.ForEach(func(k, _ []byte) error {
+			parts := strings.Split(string(k), "|")
+			evaluated, err := time.Parse(historyTimeFormat, parts[len(parts)-1])
+			if err != nil {
+				return nil
+			}
+
+			var h *HistoryConfig
+			if config, ok := tenants[parts[0]]; ok {
+				h = config.History
+			}
+			if evaluated.Before(now.AddDate(0, 0, -h.retention())) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	if removed > 0 {
+		zapLogger.Info(fmt.Sprintf("Removed %d evaluations past retention", removed))
+	}
+	return err
+}
+
+// Prunes history periodically until stopped
+func pruneHistoryLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(historyPruneInterval) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := pruneHistory(); err != nil {
+			zapLogger.Error(fmt.Sprintf("failed to prune evaluation history: %v", err))
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Returns a patient's evaluation history. The tenant is that of the token issuer, so a token only
+// reads its own tenant's patients.
+func patientHistory(c echo.Context) error {
+	config, err := currentTenants().resolve("", requestIssuer(c))
+	if err != nil {
+		logger(c.Request().Context(), err)
+		return c.NoContent(http.StatusForbidden)
+	}
+	tenant := config.Name
+	if t := c.QueryParam("tenant"); t != "" && t != tenant {
+		logger(c.Request().Context(), fmt.Errorf("history for tenant %s requested with a token for tenant %s", t, tenant))
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	patientId := c.Param("patient")
+
+	history := PatientHistory{Tenant: tenant, PatientId: patientId, Evaluations: []EvaluationRecord{}}
+	err = scanJSON(historyBucket, historyPrefix(tenant, patientId), func(_ string, data []byte) error {
+		var record EvaluationRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		history.Evaluations = append(history.Evaluations, record)
+
+		// Evaluations are in time order
+		if history.FirstEligible == nil && record.SmartEligible != nil && record.SmartEligible.Evaluation {
+			history.FirstEligible = &record.Evaluated
+		}
+		if history.FirstInitiated == nil && record.SmartInitiated != nil && record.SmartInitiated.Evaluation {
+			history.FirstInitiated = &record.Evaluated
+			history.Initiated = history.FirstEligible != nil
+		}
+		return nil
+	})
+	if err != nil {
+		logger(c.Request().Context(), err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
@@ -1,13 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"reflect"
-	"strconv"
-	"text/template"
 	"time"
 )
 
@@ -17,16 +13,16 @@ type Hook struct {
 }
 
 type Card struct {
-	UUID              string            `json:"uuid"`
-	Summary           string            `json:"summary"`
-	Detail            string            `json:"detail"`
-	Indicator         string            `json:"indicator"`
-	Source            Source            `json:"source"`
-	SelectionBehavior string            `json:"selectionBehavior"`
-	Extension         *Extension        `json:"extension"`
-	Links             []Link            `json:"links"`
-	OverrideReasons   []OverrideReasons `json:"overrideReasons"`
-	Suggestions       []Suggestion      `json:"suggestions"`
+	UUID              string       `json:"uuid"`
+	Summary           string       `json:"summary"`
+	Detail            string       `json:"detail"`
+	Indicator         string       `json:"indicator"`
+	Source            Source       `json:"source"`
+	SelectionBehavior string       `json:"selectionBehavior"`
+	Extension         *Extension   `json:"extension"`
+	Links             []Link       `json:"links"`
+	OverrideReasons   []Coding     `json:"overrideReasons,omitempty"`
+	Suggestions       []Suggestion `json:"suggestions"`
 }
 
 type Source struct {
@@ -48,7 +44,8 @@ type Suggestion struct {
 type Action struct {
 	Type        string      `json:"type"`
 	Description string      `json:"description"`
-	Resource    interface{} `json:"resource"`
+	Resource    interface{} `json:"resource,omitempty"`
+	ResourceId  string      `json:"resourceId,omitempty"`
 }
 
 type MedicationRequestAction struct {
@@ -58,6 +55,41 @@ type MedicationRequestAction struct {
 	Category                  []Category        `json:"category"`
 	MedicationCodeableConcept Category          `json:"medicationCodeableConcept"`
 	Subject                   ResourceReference `json:"subject"`
+	DosageInstruction         []DosageAction    `json:"dosageInstruction,omitempty"`
+}
+
+type DosageAction struct {
+	Text             string        `json:"text"`
+	AsNeededBoolean  bool          `json:"asNeededBoolean"`
+	Timing           *DosageTiming `json:"timing,omitempty"`
+	DoseAndRate      []DoseAndRate `json:"doseAndRate,omitempty"`
+	MaxDosePerPeriod *Ratio        `json:"maxDosePerPeriod,omitempty"`
+}
+
+type DosageTiming struct {
+	Repeat DosageRepeat `json:"repeat"`
+}
+
+type DosageRepeat struct {
+	Frequency  int    `json:"frequency"`
+	Period     int    `json:"period"`
+	PeriodUnit string `json:"periodUnit"`
+}
+
+type DoseAndRate struct {
+	DoseQuantity Quantity `json:"doseQuantity"`
+}
+
+type Quantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+	System string  `json:"system"`
+	Code   string  `json:"code"`
+}
+
+type Ratio struct {
+	Numerator   Quantity `json:"numerator"`
+	Denominator Quantity `json:"denominator"`
 }
 
 type ServiceRequestAction struct {
@@ -85,8 +117,25 @@ type ServiceRequest struct {
 	Subject      ResourceReference `json:"subject"`
 }
 
-type OverrideReasons struct {
-	Coding []Coding `json:"coding"`
+type DocumentReferenceAction struct {
+	ResourceType string            `json:"resourceType"`
+	Status       string            `json:"status"`
+	DocStatus    string            `json:"docStatus"`
+	Type         Category          `json:"type"`
+	Subject      ResourceReference `json:"subject"`
+	Date         string            `json:"date"`
+	Content      []DocumentContent `json:"content"`
+}
+
+type DocumentContent struct {
+	Attachment Attachment `json:"attachment"`
+}
+
+type Attachment struct {
+	ContentType string `json:"contentType"`
+	Language    string `json:"language,omitempty"`
+	Data        string `json:"data"`
+	Title       string `json:"title,omitempty"`
 }
 
 type SystemActions struct {
@@ -109,60 +158,18 @@ func parseCDSHooksRequest(body io.Reader) (HookRequest, error) {
 	return hookRequest, nil
 }
 
-func generateCardDetail(m map[string]string, fileName string) (string, error) {
-	tmpl := template.Must(template.ParseFiles(fileName))
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, m); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
-
-func structToMap(s any) map[string]string {
-	// Initialize map
-	result := make(map[string]string)
-
-	// Create value and type fields
-	val := reflect.ValueOf(s)
-	typ := reflect.TypeOf(s)
-
-	// Iterate over struct fields
-	for i := range val.NumField() {
-		field := typ.Field(i)
-		value := val.Field(i)
-
-		// Convert valus to string
-		var strValue string
-		switch value.Kind() {
-		case reflect.Bool:
-			strValue = strconv.FormatBool(value.Bool())
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			strValue = strconv.FormatInt(value.Int(), 10)
-		case reflect.String:
-			strValue = value.String()
-		default:
-			strValue = fmt.Sprintf("%v", value.Interface()) // Fallback for other types
-		}
-
-		// Append result to map
-		result[field.Name] = strValue
-	}
-	return result
-}
-
-func (h *Hook) addCard(detail string) {
+func (h *Hook) addCard(summary, detail string) {
 	// Get string formated time
 	formattedTime := time.Now().Format("20060102150405")
 
 	// Build card
 	h.Cards = append(h.Cards, Card{
-		Summary:   "Patient Eligible for SMART Asthma Therapy",
+		Summary:   summary,
 		Indicator: "info",
 		Extension: &Extension{
 			ContentType: "text/html",
 		},
-		Detail: "<p hidden>" + detail + "</p>",
+		Detail: detail,
 		Source: Source{
 			Topic: &Coding{
 				Code: fmt.Sprintf("SMARTAsthma%s", formattedTime),
@@ -178,7 +185,7 @@ func (h *Hook) addSuggestion(card int) {
 	}
 }
 
-func (h *Hook) addOrderSetSuggestion(card int, patId string) {
+func (h *Hook) addOrderSetSuggestion(card int, patId, orderSetKey string) {
 	// Check if suggestions list exists, if not, build it
 	if h.Cards[card].Suggestions == nil {
 		h.addSuggestion(card)
@@ -187,38 +194,11 @@ func (h *Hook) addOrderSetSuggestion(card int, patId string) {
 	// Build MedicationRequest suggestion
 	suggestion := Suggestion{
 		Label: "SMART Asthma SmartSet",
-		UUID:  "order-set-request-test",
 		Actions: []Action{
 			{
 				Type:        "create",
 				Description: "SMART Asthma Therapy",
-				Resource: ServiceRequest{
-					ResourceType: "ServiceRequest",
-					Status:       "draft",
-					Intent:       "proposal",
-					Category: []Category{
-						{
-							Coding: []Coding{
-								{
-									System:  "http://terminology.hl7.org/CodeSystem/medicationrequest-category",
-									Code:    "outpatient",
-									Display: "Outpatient",
-								},
-							},
-						},
-					},
-					Code: Category{
-						Coding: []Coding{
-							{
-								System: "urn:com.epic.cdshooks.action.code.system.orderset-item",
-								Code:   config.OrderSetKey,
-							},
-						},
-					},
-					Subject: ResourceReference{
-						Reference: fmt.Sprintf("Patient/%s", patId),
-					},
-				},
+				Resource:    orderSetRequest(patId, orderSetKey),
 			},
 		},
 	}
@@ -226,3 +206,34 @@ func (h *Hook) addOrderSetSuggestion(card int, patId string) {
 	// Append suggestion to current suggestion list
 	h.Cards[card].Suggestions = append(h.Cards[card].Suggestions, suggestion)
 }
+
+// Builds a draft request for the SMART Asthma order set
+func orderSetRequest(patId, orderSetKey string) ServiceRequest {
+	return ServiceRequest{
+		ResourceType: "ServiceRequest",
+		Status:       "draft",
+		Intent:       "proposal",
+		Category: []Category{
+			{
+				Coding: []Coding{
+					{
+						System:  "http://terminology.hl7.org/CodeSystem/medicationrequest-category",
+						Code:    "outpatient",
+						Display: "Outpatient",
+					},
+				},
+			},
+		},
+		Code: Category{
+			Coding: []Coding{
+				{
+					System: "urn:com.epic.cdshooks.action.code.system.orderset-item",
+					Code:   orderSetKey,
+				},
+			},
+		},
+		Subject: ResourceReference{
+			Reference: fmt.Sprintf("Patient/%s", patId),
+		},
+	}
+}
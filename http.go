@@ -2,6 +2,7 @@ package main
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -29,20 +30,20 @@ type ResponseResult struct {
 	Body     []byte
 }
 
-func sendRequest(method, url string, queryParams url.Values, headers map[string]string, body io.Reader, timeout ...int) (*http.Response, error) {
+func sendRequest(ctx context.Context, method, url string, queryParams url.Values, headers map[string]string, body io.Reader, timeout ...int) (*http.Response, error) {
 	// Get timeout value, if passed, or use environment variable
 	t := globalTimeout
 	if len(timeout) > 0 {
 		t = timeout[0]
 	}
 
-	// Create new HTTP client with timeout
-	client := http.Client{
+	// Create new HTTP client with timeout. Trace context is propagated to the server, if active.
+	client := traceClient(ctx, &http.Client{
 		Timeout: time.Duration(time.Duration(t) * time.Second),
-	}
+	})
 
 	// Create a new request
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +129,7 @@ func splitRequest(api string, split, lookback int, queryParams url.Values, heade
 	return requestList
 }
 
-func sendAll(requestList []Request, headers map[string]string, responseResults chan<- ResponseResult, wg *sync.WaitGroup) {
+func sendAll(ctx context.Context, requestList []Request, headers map[string]string, responseResults chan<- ResponseResult, wg *sync.WaitGroup) {
 
 	// Iterate over requests and send in parallel
 	for _, request := range requestList {
@@ -140,7 +141,7 @@ func sendAll(requestList []Request, headers map[string]string, responseResults c
 			defer wg.Done()
 
 			// Send request
-			resp, err := sendRequest(request.Method, request.URL, request.QueryParams, headers, request.Body)
+			resp, err := sendRequest(ctx, request.Method, request.URL, request.QueryParams, headers, request.Body)
 
 			// Send response or error back to channel
 			responseResults <- ResponseResult{Response: resp, Error: err}
@@ -186,7 +187,17 @@ func (er *EligibilityRequest) processResults(responseResults chan ResponseResult
 	return responses, nil
 }
 
-func (er *EligibilityRequest) sendAndProcess(requestList []Request, headers map[string]string) error {
+func (er *EligibilityRequest) sendAndProcess(ctx context.Context, requestList []Request, headers map[string]string) error {
+	// Record fetch latency by resource type
+	start := time.Now()
+	resource := "unknown"
+	if len(requestList) > 0 {
+		resource = resourceName(er.Host, requestList[0].URL)
+	}
+	defer func() {
+		fhirFetchDuration.WithLabelValues(er.Config.Name, resource).Observe(time.Since(start).Seconds())
+	}()
+
 	// Create sub-wait group
 	var subWg sync.WaitGroup
 
@@ -194,7 +205,7 @@ func (er *EligibilityRequest) sendAndProcess(requestList []Request, headers map[
 	responseCh := make(chan ResponseResult, len(requestList))
 
 	// Send all requests
-	sendAll(requestList, headers, responseCh, &subWg)
+	sendAll(ctx, requestList, headers, responseCh, &subWg)
 
 	// Close channel once all goroutines are finished
 	go func() {
@@ -205,12 +216,14 @@ func (er *EligibilityRequest) sendAndProcess(requestList []Request, headers map[
 	// Process results, checking for errors
 	responses, err := er.processResults(responseCh)
 	if err != nil {
+		fhirFetchErrors.WithLabelValues(er.Config.Name, resource).Inc()
 		return err
 	}
 
 	// Parse response into FHIR structs
 	for _, result := range responses {
 		if err := er.processFHIRResponse(result.Body); err != nil {
+			fhirFetchErrors.WithLabelValues(er.Config.Name, resource).Inc()
 			logger(er.Context.RequestContext, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
 			return err
 		}
@@ -219,8 +232,8 @@ func (er *EligibilityRequest) sendAndProcess(requestList []Request, headers map[
 	return nil
 }
 
-func createChunks(values []string, chunkSize int) [][]string {
-	var chunks [][]string
+func createChunks[T any](values []T, chunkSize int) [][]T {
+	var chunks [][]T
 	for chunkSize < len(values) {
 		values, chunks = values[chunkSize:], append(chunks, values[0:chunkSize:chunkSize])
 	}
@@ -1,35 +1,28 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"log"
 	"os"
+	"strconv"
 )
 
-var (
-	configFile string = getEnv("CONFIG_FILE", "config.json")
-)
-
-func readConfig() (*Config, error) {
-	// Get endpoint list
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		return nil, fmt.Errorf("error reading endpoint file:%s", err)
-	}
-
-	// Parse JSON data
-	var config Config
-	err = json.Unmarshal(data, &config)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing JSON:%s", err)
-	}
-
-	return &config, nil
-}
-
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue
+	}
+
+	// Convert value to integer
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Failed to convert %s environment variable to integer", key)
+	}
+	return i
+}
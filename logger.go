@@ -6,12 +6,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/labstack/echo/v4"
-	"go.elastic.co/apm"
-	"go.elastic.co/apm/module/apmechov4"
 	"go.elastic.co/apm/module/apmzap"
 	"go.uber.org/zap"
 )
@@ -22,6 +20,7 @@ var (
 	appName   string = os.Getenv("APP_NAME")
 	apmActive string = os.Getenv("ELASTIC_APM_ACTIVE")
 	elkUrl    string = os.Getenv("ELK_URL")
+	elkShip   *elkShipper
 )
 
 func init() {
@@ -33,42 +32,35 @@ func init() {
 		log.Fatalf("Can't initialize zap logger: %v", err)
 	}
 
+	// Create ELK shipper. This is started from main.
+	elkShip = newElkShipper(elkUrl)
+
 	// Flushes buffer if it exists
 	defer zapLogger.Sync()
 }
 
-func initAPM(e *echo.Echo) {
-	// Close default Elastic APM tracer
-	zapLogger.Info("Disable default APM logger")
-	apm.DefaultTracer.Close()
-
-	// Conditionally enable APM logger based on "ELASTIC_APM_ACTIVE" environment variable.
-	if apmActive == "true" {
-		// Create new tracer with basic options
-		// Use environment variables for the remaining options
-		zapLogger.Info("Creating new APM tracer",
-			zap.String("ServiceName", appName),
-			zap.String("ServiceEnvironment", appEnv))
-		tracer, err := apm.NewTracerOptions(apm.TracerOptions{
-			ServiceName:        appName,
-			ServiceEnvironment: appEnv,
-		})
-		if err != nil {
-			zapLogger.Fatal(err.Error())
-		}
+type tenantKey struct{}
 
-		// Adds elastic APM middleware to web server to capture requests
-		// and send them to elastic
-		zapLogger.Info("Enabling APM logger")
-		e.Use(apmechov4.Middleware(apmechov4.WithTracer(tracer)))
+func logger(c context.Context, err error) {
+	fields := traceFields(c)
+	if tenant := tenantFromContext(c); tenant != "" {
+		fields = append(fields, zap.String("tenant", tenant))
 	}
+	zapLogger.Error(err.Error(), fields...)
+	captureError(c, err)
 }
 
-func logger(c context.Context, err error) {
-	zapLogger.Error(err.Error())
-	if apmActive == "true" {
-		apm.CaptureError(c, err).Send()
+// Adds the tenant name to a context so it is included in logs
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func tenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
 	}
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
 }
 
 func elkLogger(msg map[string]string, level string) error {
@@ -91,33 +83,14 @@ func elkLogger(msg map[string]string, level string) error {
 	msg["level"] = level
 	msg["date"] = datetime
 
-	// Build request body
-	bodyReader, err := readerFromMap(msg)
+	// Build document
+	doc, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	// Set headers for request
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-
-	// Send log message
-	resp, err := sendRequest("POST", elkUrl, nil, headers, bodyReader, 5)
-	if err != nil {
-		return err
-	}
-
-	// Read the body
-	body, err := readBody(resp)
-	if err != nil {
-		return err
-	}
-
-	// Verify status code
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("log message failed (Patient - %s, Status Code - %d): %s", msg["mrn"], resp.StatusCode, string(body))
-	}
+	// Queue log message. Delivery is handled by the background shipper.
+	elkShip.enqueue(doc)
 
 	return nil
 }
@@ -129,13 +102,10 @@ func (er *EligibilityRequest) sendWebLog(msg string) {
 	// Add log message to map
 	message["msg"] = msg
 
-	// Send log message in a separate thread to avoid slowing down the response
-	go func() {
-		// Send log message with current evaluation
-		if err := elkLogger(message, "info"); err != nil {
-			logger(er.Context.RequestContext, fmt.Errorf("%v. Context: %s ", err, er.Context.Body))
-		}
-	}()
+	// Queue log message with current evaluation. This does not block the response.
+	if err := elkLogger(message, "info"); err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("%v. Context: %s ", err, er.Context.Body))
+	}
 }
 
 func (er *EligibilityRequest) getWebLogContext() map[string]string {
@@ -147,19 +117,41 @@ func (er *EligibilityRequest) getWebLogContext() map[string]string {
 	}
 
 	// Return map with contextual details about the request
-	return map[string]string{
-		"application": appName,
-		"mrn":         er.Context.Patient.MRN,
-		"patFHIRId":   er.Context.Patient.Id,
-		"encId":       encId,
+	context := map[string]string{
+		"application":     appName,
+		"tenant":          er.Config.Name,
+		"criteriaVersion": er.Config.CriteriaVersion,
+		"mrn":             er.Context.Patient.MRN,
+		"patFHIRId":       er.Context.Patient.Id,
+		"encId":           encId,
 	}
-}
 
-// Creates a string reader from a map
-func readerFromMap(m map[string]string) (*strings.Reader, error) {
-	jsonBytes, err := json.Marshal(m)
-	if err != nil {
-		return nil, err
+	// Record the asthma control assessment
+	if control := er.Criteria.Control; control != nil {
+		context["asthmaControl"] = control.Control
+		context["naeppStep"] = strconv.Itoa(control.Step)
+		context["exacerbations365"] = strconv.Itoa(control.Exacerbations)
+	}
+
+	// Record controller adherence
+	if adherence := er.Criteria.Adherence; adherence != nil {
+		context["pdc"] = strconv.FormatFloat(adherence.PDC, 'f', 2, 64)
+		context["pdcSource"] = adherence.Source
+	}
+
+	// Record allergies to SMART medications
+	if len(er.Criteria.Contraindications) > 0 {
+		var rules []string
+		for _, ci := range er.Criteria.Contraindications {
+			rules = append(rules, ci.Rule)
+		}
+		context["contraindications"] = strings.Join(rules, ",")
 	}
-	return strings.NewReader(string(jsonBytes)), nil
+
+	// Record why a card was not shown
+	if er.Suppression != "" {
+		context["suppressionReason"] = er.Suppression
+	}
+
+	return context
 }
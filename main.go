@@ -1,17 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-)
-
-var (
-	config *Config
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func init() {
@@ -31,23 +33,35 @@ func init() {
 			log.Fatalf("Failed to convert timeout environment variable to integer")
 		}
 	}
+}
+
+func main() {
+	// Validate a configuration file without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(validateConfigCommand(os.Args[2:]))
+	}
 
-	// Read list of requests
-	config, err = readConfig()
-	if err != nil {
+	// Read and validate configuration
+	if err := loadConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Open local store for cards and feedback
+	if err := openStore(); err != nil {
 		log.Fatal(err)
 	}
-}
 
-func main() {
 	// Create new Echo object
 	e := echo.New()
 
 	// Add basic middleware to log all requests
 	e.Use(middleware.Logger())
 
-	// Configure elastic apm logging
-	initAPM(e)
+	// Limit request body size
+	e.Use(middleware.BodyLimit(bodyLimit))
+
+	// Configure tracing (Elastic APM or OpenTelemetry)
+	shutdownTracing := initTracing(e)
 
 	// Sets CORS headers to allow all origins, but restrict HTTP method type
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
@@ -59,11 +73,16 @@ func main() {
 	// This must go after the Elastic APM middleware
 	e.Use(filterError)
 
-	// Adds a heartbeat handler
+	// Adds a heartbeat handler, and liveness and readiness probes
 	e.GET("/heartbeat", heartbeat)
+	e.GET("/livez", livez)
+	e.GET("/readyz", readyz)
 
-	// Creats API group to simplify middleware declaration
-	cdsGroup := e.Group("/cds-services")
+	// Exposes Prometheus metrics
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// Creats API group to simplify middleware declaration. Hooks are tracked so shutdown can wait for them.
+	cdsGroup := e.Group("/cds-services", hooks.track)
 
 	// Add a GET handler for presenting the CDS Hooks services available
 	cdsGroup.GET("", cdsServices)
@@ -71,6 +90,80 @@ func main() {
 	// Add a POST handler for CDS Hooks service
 	cdsGroup.POST("/eligibility", eligibility, openId)
 
+	// Add POST handlers for the order hooks
+	cdsGroup.POST("/order-select", orderSelect, openId)
+	cdsGroup.POST("/order-sign", orderSign, openId)
+
+	// Add a POST handler for CDS Hooks feedback
+	cdsGroup.POST("/:id/feedback", feedback, openId)
+
+	// Serves the SMART app that explains the evaluation, launched from the eligibility card
+	appGroup := e.Group("/app")
+	appGroup.GET("", appPage)
+	appGroup.GET("/launch", appLaunch)
+	appGroup.GET("/callback", appCallback)
+	appGroup.GET("/action-plan", appActionPlan)
+
+	// Returns a draft SMART action plan for a patient
+	e.POST("/api/action-plan", actionPlanAPI, hooks.track, openId)
+
+	// Creates API group for internal reporting, for tokens with the reporting scope
+	internalGroup := e.Group("/internal", reporting)
+	internalGroup.GET("/feedback", feedbackSummary)
+	internalGroup.GET("/history/:patient", patientHistory)
+
+	// Start shipping log events to ELK in the background
+	elkShip.start()
+
+	// Reload configuration on SIGHUP or file change
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go watchConfig(stopWatch)
+
+	// Configure address, timeouts and TLS, reloading certificates as they change
+	if err := configureServer(e.Server); err != nil {
+		log.Fatal(err)
+	}
+	go certs.watch(stopWatch)
+
+	// Remove evaluations past each tenant's retention
+	go pruneHistoryLoop(stopWatch)
+
 	// Start server
-	e.Logger.Fatal(e.Start(":8000"))
+	go func() {
+		if err := e.StartServer(e.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// Wait for an interrupt or termination signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	// Refuse new hooks, and give load balancers time to stop routing to this instance
+	hooks.drain()
+	zapLogger.Info("Shutting down")
+	time.Sleep(time.Duration(shutdownDelay) * time.Second)
+
+	// Stop the server, wait for in-flight evaluations and writebacks, and flush queued log events
+	// before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout)*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		zapLogger.Error(err.Error())
+	}
+	if err := hooks.wait(ctx); err != nil {
+		zapLogger.Error(err.Error())
+	}
+	if err := elkShip.Close(ctx); err != nil {
+		zapLogger.Error(err.Error())
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		zapLogger.Error(err.Error())
+	}
+	if err := closeStore(); err != nil {
+		zapLogger.Error(err.Error())
+	}
+	_ = zapLogger.Sync()
 }
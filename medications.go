@@ -2,21 +2,14 @@ package main
 
 import (
 	"net/url"
-	"os"
-	"regexp"
 	"sort"
 	"sync"
 
-	"go.elastic.co/apm"
+	"github.com/chop-dbhi/smart-asthma/fhir"
 )
 
-// Should move to central config to support other medication vocabularies
-var (
-	antiasthmaticsGPIRegex = regexp.MustCompile(os.Getenv("ANTI_ASTHMATIC_REGEX"))
-	biologicGPIRegex       = regexp.MustCompile(os.Getenv("BIOLOGIC_REGEX"))
-	controllerRegex        = regexp.MustCompile(os.Getenv("CONTROLLER_REGEX"))
-	icsfRegex              = regexp.MustCompile(os.Getenv("ICSF_REGEX"))
-	steroidRegex           = regexp.MustCompile(os.Getenv("STEROID_REGEX"))
+const (
+	gpiSystem string = "urn:oid:2.16.840.1.113883.6.68"
 )
 
 type MedicationRequest struct {
@@ -25,13 +18,18 @@ type MedicationRequest struct {
 	Status              string              `json:"status"`
 	Intent              string              `json:"intent"`
 	MedicationReference MedicationReference `json:"medicationReference"`
+	MedicationCode      Category            `json:"medicationCodeableConcept"`
 	EncounterReference  ResourceReference   `json:"encounter"`
 	AuthoredOn          Date                `json:"authoredOn"`
 	Requester           ResourceReference   `json:"requester"`
 	Recorder            ResourceReference   `json:"recorder"`
 	DosageInstruction   []DosageInstruction `json:"dosageInstruction"`
+	DispenseRequest     DispenseRequest     `json:"dispenseRequest"`
 	Class               string
 	SubClass            string
+
+	// Contained resources, such as a contained Medication or Condition
+	Contained []fhir.RawResource `json:"contained"`
 }
 
 type MedicationReference struct {
@@ -45,7 +43,15 @@ type DosageInstruction struct {
 			BoundsPeriod Period `json:"boundsPeriod"`
 		} `json:"repeat"`
 	} `json:"timing"`
-	AsNeeded bool `json:"asNeededBoolean"`
+	AsNeeded    bool      `json:"-"`
+	AsNeededFor *Category `json:"-"`
+}
+
+type DispenseRequest struct {
+	ValidityPeriod         Period   `json:"validityPeriod"`
+	NumberOfRepeatsAllowed int      `json:"numberOfRepeatsAllowed"`
+	Quantity               Quantity `json:"quantity"`
+	ExpectedSupplyDuration Quantity `json:"expectedSupplyDuration"`
 }
 
 type Medication struct {
@@ -61,7 +67,7 @@ func (er *EligibilityRequest) getMedications(wg *sync.WaitGroup, errCh chan<- er
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Medications")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Medications")
 	defer span.End()
 
 	// Initialize query parameters
@@ -75,7 +81,7 @@ func (er *EligibilityRequest) getMedications(wg *sync.WaitGroup, errCh chan<- er
 	requestList := splitRequest(er.Host+"/MedicationRequest", 2, 365, queryParams, headers)
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -120,41 +126,57 @@ func (er *EligibilityRequest) processMedications() {
 
 func (er *EligibilityRequest) linkMedicationCode() {
 	for _, mr := range er.Data.MedicationRequests {
-		// Check if key exists
-		med, ok := er.Data.Medications[mr.MedicationReference.Reference]
+		// Check if the referenced medication was found
+		med, ok := er.referencedMedication(mr)
 		if !ok {
+			// Fall back to an inline medication code, as used by draft orders
+			mr.MedicationReference.VocabularyCode = gpiCode(mr.MedicationCode.Coding)
 			continue
 		}
 		// Check if we've already evaluated this medication
 		if med.GPI == "" {
-			// Loop through codes and add those of interest
-			for _, code := range med.Code.Coding {
-				if code.System == "urn:oid:2.16.840.1.113883.6.68" {
-					med.GPI = code.Code
-				}
-			}
+			med.GPI = gpiCode(med.Code.Coding)
 		}
 		// Set the code on the MedicationRequest resource
 		mr.MedicationReference.VocabularyCode = med.GPI
 	}
 }
 
+// Returns the GPI code from a list of codings
+func gpiCode(codings []Coding) string {
+	var gpi string
+	for _, code := range codings {
+		if code.System == gpiSystem {
+			gpi = code.Code
+		}
+	}
+	return gpi
+}
+
+// Checks for a combined dose/signature, based on a PRN and scheduled dosage instruction
+func hasComboSig(mr *MedicationRequest) bool {
+	if len(mr.DosageInstruction) == 2 {
+		return mr.DosageInstruction[0].AsNeeded != mr.DosageInstruction[1].AsNeeded
+	}
+	return false
+}
+
 // Classifies medication according to characteristics of the medication
 func (er *EligibilityRequest) classifyMedications() {
 	for _, mr := range er.Data.MedicationRequests {
 		code := mr.MedicationReference.VocabularyCode
-		if antiasthmaticsGPIRegex.MatchString(code) {
+		if er.Config.Codes.AntiAsthmatic.MatchString(code) {
 			er.Maps.MedicationType["antiasthmatic"][mr.Id] = 1
 		}
-		if biologicGPIRegex.MatchString(code) {
+		if er.Config.Codes.Biologic.MatchString(code) {
 			er.Maps.MedicationType["biologic"][mr.Id] = 1
 			er.Data.BiologicMedicationRequests = append(er.Data.BiologicMedicationRequests, mr)
 		}
-		if controllerRegex.MatchString(code) {
+		if er.Config.Codes.Controller.MatchString(code) {
 			er.Maps.MedicationType["controller"][mr.Id] = 1
 			er.Data.ControllerMedicationRequests = append(er.Data.ControllerMedicationRequests, mr)
 		}
-		if steroidRegex.MatchString(code) {
+		if er.Config.Codes.Steroid.MatchString(code) {
 			er.Maps.MedicationType["steroid"][mr.Id] = 1
 			er.Data.SteroidMedicationRequests = append(er.Data.SteroidMedicationRequests, mr)
 		}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace string = "smart_asthma"
+
+	// Outcomes of a hook request
+	outcomeCardShown     string = "card_shown"
+	outcomeNotEligible   string = "not_eligible"
+	outcomeNotInRegistry string = "not_in_registry"
+	outcomeNotApplicable string = "not_applicable"
+	outcomeSuppressed    string = "suppressed"
+	outcomeError         string = "error"
+)
+
+var (
+	hookRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "hook_requests_total",
+		Help:      "Number of CDS Hooks requests by service and outcome.",
+	}, []string{"tenant", "service", "outcome"})
+
+	hookDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "hook_request_duration_seconds",
+		Help:      "CDS Hooks request latency by service and outcome.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 3, 5, 8, 13, 21, 30},
+	}, []string{"tenant", "service", "outcome"})
+
+	fhirFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fhir_fetch_duration_seconds",
+		Help:      "Latency of fetching and parsing a FHIR resource type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"tenant", "resource"})
+
+	fhirFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "fhir_fetch_errors_total",
+		Help:      "Number of failed fetches by FHIR resource type.",
+	}, []string{"tenant", "resource"})
+
+	writebacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "writebacks_total",
+		Help:      "Number of SmartData writebacks to the EHR by result.",
+	}, []string{"tenant", "result"})
+
+	criterionEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "criterion_evaluations_total",
+		Help:      "Number of SMART eligibility criterion evaluations by criterion and result.",
+	}, []string{"tenant", "criterion", "result"})
+
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_failures_total",
+		Help:      "Number of rejected requests by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	// Expose ELK shipper counters
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "elk_events_queued",
+		Help:      "Number of log events waiting in the ELK queue.",
+	}, func() float64 {
+		return float64(elkShip.Stats().Queued)
+	})
+
+	elkCounters := map[string]func(ElkStats) int64{
+		"sent":    func(s ElkStats) int64 { return s.Sent },
+		"spilled": func(s ElkStats) int64 { return s.Spilled },
+		"dropped": func(s ElkStats) int64 { return s.Dropped },
+		"failed":  func(s ElkStats) int64 { return s.Failed },
+	}
+	for name, value := range elkCounters {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "elk_events_" + name + "_total",
+			Help:      "Number of log events " + name + " by the ELK shipper.",
+		}, func() float64 {
+			return float64(value(elkShip.Stats()))
+		})
+	}
+}
+
+// Records the outcome and latency of a hook request
+func observeHook(tenant, service, outcome string, start time.Time) {
+	if tenant == "" {
+		tenant = "unknown"
+	}
+	hookRequests.WithLabelValues(tenant, service, outcome).Inc()
+	hookDuration.WithLabelValues(tenant, service, outcome).Observe(time.Since(start).Seconds())
+}
+
+// Records the result of each boolean criterion in a criteria struct
+func observeCriteria(tenant string, criteria any) {
+	val := reflect.Indirect(reflect.ValueOf(criteria))
+	typ := val.Type()
+
+	for i := range val.NumField() {
+		if val.Field(i).Kind() != reflect.Bool {
+			continue
+		}
+		criterionEvaluations.WithLabelValues(tenant, typ.Field(i).Name, strconv.FormatBool(val.Field(i).Bool())).Inc()
+	}
+}
+
+// Extracts the FHIR resource type from a request URL relative to the FHIR base URL
+func resourceName(host, requestURL string) string {
+	path := strings.TrimPrefix(requestURL, host)
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+	resource, _, _ := strings.Cut(strings.TrimLeft(path, "/"), "/")
+	if resource == "" {
+		return "unknown"
+	}
+	return resource
+}
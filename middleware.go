@@ -8,12 +8,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
-	"go.elastic.co/apm"
 )
 
 var (
 	authHost string = os.Getenv("AUTH_HOST")
+
+	// Scope required for internal reporting, which hook tokens are not granted
+	reportingScope string = getEnv("REPORTING_SCOPE", "smart-asthma/reporting")
 )
 
 const (
@@ -46,12 +49,14 @@ func openId(next echo.HandlerFunc) echo.HandlerFunc {
 
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
+			authFailures.WithLabelValues("missing_header").Inc()
 			logger(r.Context(), errors.New("authorization header not found"))
 			return c.NoContent(http.StatusUnauthorized)
 		}
 
 		err := sendAuth("openid", authHeader, r)
 		if err != nil {
+			authFailures.WithLabelValues("auth_service").Inc()
 			logger(r.Context(), err)
 			return c.NoContent(http.StatusUnauthorized)
 		}
@@ -59,6 +64,7 @@ func openId(next echo.HandlerFunc) echo.HandlerFunc {
 		// Convert auth header to token and store on request object
 		token, err := parseToken(authHeader)
 		if err != nil {
+			authFailures.WithLabelValues("invalid_token").Inc()
 			logger(r.Context(), err)
 			return c.NoContent(http.StatusUnauthorized)
 		}
@@ -71,20 +77,33 @@ func openId(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// Verifies the token as openId does and requires the reporting scope
+func reporting(next echo.HandlerFunc) echo.HandlerFunc {
+	return openId(func(c echo.Context) error {
+		token, ok := c.Get("user").(*jwt.Token)
+		if !ok || !hasScope(token, reportingScope) {
+			authFailures.WithLabelValues("missing_scope").Inc()
+			logger(c.Request().Context(), fmt.Errorf("token does not have the %s scope", reportingScope))
+			return c.NoContent(http.StatusForbidden)
+		}
+		return next(c)
+	})
+}
+
 func sendAuth(api string, authHeader string, r *http.Request) error {
 	// Create span
-	span, _ := apm.StartSpan(r.Context(), "Authorize Request", "OpenId")
+	span, ctx := startSpan(r.Context(), "Authorize Request", "OpenId")
 	defer span.End()
 
 	// Send http request to auth service
 	// If it fails, fail the request
 	// Create new HTTP client
-	client := http.Client{
+	client := traceClient(ctx, &http.Client{
 		Timeout: time.Duration(5 * time.Second),
-	}
+	})
 
 	// Create new request
-	req, err := http.NewRequest("POST", authHost+api, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", authHost+api, nil)
 	if err != nil {
 		return err
 	}
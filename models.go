@@ -3,8 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
+	"html/template"
+	"regexp"
 	"time"
+
+	"github.com/chop-dbhi/smart-asthma/fhir"
 )
 
 /**************************
@@ -19,7 +22,7 @@ type Service struct {
 	Title             string            `json:"title"`
 	Description       string            `json:"description"`
 	Id                string            `json:"id"`
-	Prefetch          map[string]string `json:"prefetch"`
+	Prefetch          map[string]string `json:"prefetch,omitempty"`
 	UsageRequirements string            `json:"usageRequirements"`
 }
 
@@ -34,10 +37,12 @@ type HookRequest struct {
 		AccessToken string `json:"access_token"`
 	} `json:"fhirAuthorization"`
 	Context struct {
-		PatientId   string `json:"patientId"`
-		EncounterId string `json:"encounterId"`
-		UserId      string `json:"userId"`
-	}
+		PatientId   string          `json:"patientId"`
+		EncounterId string          `json:"encounterId"`
+		UserId      string          `json:"userId"`
+		Selections  []string        `json:"selections"`
+		DraftOrders json.RawMessage `json:"draftOrders"`
+	} `json:"context"`
 }
 
 /****************************************
@@ -66,6 +71,9 @@ type ResourceReference struct {
 	Reference    string `json:"reference"`
 	Type         string `json:"type"`
 	Display      string `json:"display"`
+
+	// Reference as received, before parsing
+	Literal string `json:"-"`
 }
 
 /*********************************
@@ -80,6 +88,7 @@ type Period struct {
 // Create custom date type
 type Date struct {
 	time.Time
+	Precision DatePrecision
 }
 
 type Identifier struct {
@@ -93,13 +102,152 @@ type Identifier struct {
  ********** App Config **********
  ********************************/
 
+// Set of tenant configurations, keyed by tenant name
+type TenantRegistry struct {
+	Tenants map[string]*Config `json:"tenants"`
+}
+
+// Configuration for a single tenant (EHR instance)
 type Config struct {
-	AlertTextLocation string                 `json:"alertTextLocation"`
-	AsthmaActionPlan  AsthmaActionPlanConfig `json:"asthmaActionPlan"`
-	ObservationOID    string                 `json:"observationOID"`
-	AsthmaControlTool map[string]bool        `json:"asthmaControlTool"`
-	OrderSetKey       string                 `json:"orderSetKey"`
-	SystemUser        string                 `json:"systemUser"`
+	Name                   string                 `json:"-"`
+	FHIRServers            []string               `json:"fhirServers"`
+	Issuers                []string               `json:"issuers"`
+	CriteriaVersion        string                 `json:"criteriaVersion"`
+	Writeback              string                 `json:"writeback"`
+	ValueSets              ValueSetConfig         `json:"valueSets"`
+	AlertTextLocation      string                 `json:"alertTextLocation"`
+	AsthmaActionPlan       AsthmaActionPlanConfig `json:"asthmaActionPlan"`
+	ObservationOID         string                 `json:"observationOID"`
+	AsthmaControlTool      map[string]bool        `json:"asthmaControlTool"`
+	AsthmaControlScores    *ControlScoreConfig    `json:"asthmaControlScores"`
+	OrderSetKey            string                 `json:"orderSetKey"`
+	SmartMedication        *Coding                `json:"smartMedication"`
+	OverrideReasons        []Coding               `json:"overrideReasons"`
+	Suppression            *SuppressionConfig     `json:"suppression"`
+	Exacerbations          *ExacerbationConfig    `json:"exacerbations"`
+	Adherence              *AdherenceConfig       `json:"adherence"`
+	Contraindications      []ContraindicationRule `json:"contraindications"`
+	PrimaryCare            *PrimaryCareConfig     `json:"primaryCare"`
+	TestPatients           *TestPatientConfig     `json:"testPatients"`
+	History                *HistoryConfig         `json:"history"`
+	SmartApp               *SmartAppConfig        `json:"smartApp"`
+	Language               string                 `json:"language"`
+	Formulary              []FormularyProduct     `json:"formulary"`
+	ActionPlanDocumentType *Coding                `json:"actionPlanDocumentType"`
+	SystemUser             string                 `json:"systemUser"`
+	Codes                  *ValueSets             `json:"-"`
+	Templates              *template.Template     `json:"-"`
+}
+
+// Keeps a snapshot of each evaluation. Evaluations older than the retention are removed, as are a
+// patient's oldest evaluations beyond the limit per patient, if set.
+type HistoryConfig struct {
+	RetentionDays int `json:"retentionDays"`
+	MaxPerPatient int `json:"maxPerPatient"`
+}
+
+// SMART on FHIR client registration of the explanation app
+type SmartAppConfig struct {
+	ClientId string `json:"clientId"`
+	Scope    string `json:"scope"`
+}
+
+// Limits how often a card is shown. Suppression resets when the evidence behind the card changes.
+type SuppressionConfig struct {
+	PerUser      bool           `json:"perUser"`
+	MaxCards     int            `json:"maxCards"`
+	IntervalDays int            `json:"intervalDays"`
+	SnoozeDays   map[string]int `json:"snoozeDays"`
+}
+
+// Asthma Control Tool IDs whose responses are ACT (12 years and older) or C-ACT (4 to 11 years)
+// item scores rather than a status
+type ControlScoreConfig struct {
+	ACT  []string `json:"act"`
+	CACT []string `json:"cAct"`
+}
+
+// Controls how SCS courses and acute care encounters are merged into exacerbations
+type ExacerbationConfig struct {
+	WindowDays       int  `json:"windowDays"`
+	IncludeAcuteCare bool `json:"includeAcuteCare"`
+}
+
+// Controls how controller adherence is estimated and whether it is a SMART criterion
+type AdherenceConfig struct {
+	Dispenses bool    `json:"dispenses"`
+	MinPDC    float64 `json:"minPDC"`
+}
+
+// Allergy or intolerance that contraindicates SMART. Codes and text are regular expressions matched
+// against the allergen's codes and names.
+type ContraindicationRule struct {
+	Name    string `json:"name"`
+	Codes   string `json:"codes"`
+	Text    string `json:"text"`
+	Action  string `json:"action"`
+	codesRe *regexp.Regexp
+	textRe  *regexp.Regexp
+}
+
+// Attributes patients to primary care. Practices is a regular expression matched against the
+// reference or name of the encounter's service provider, the patient's general practitioner and the
+// care team's members and managing organization. It matches every practice when empty.
+type PrimaryCareConfig struct {
+	WellVisitMonths     int    `json:"wellVisitMonths"`
+	GeneralPractitioner bool   `json:"generalPractitioner"`
+	CareTeam            bool   `json:"careTeam"`
+	Practices           string `json:"practices"`
+	practicesRe         *regexp.Regexp
+}
+
+// Identifies test patients, who are excluded from the asthma registry. Names is a regular expression
+// matched against the patient's names. Tags default to the HL7 HTEST security label.
+type TestPatientConfig struct {
+	Ids               []string `json:"ids"`
+	IdentifierSystems []string `json:"identifierSystems"`
+	Names             string   `json:"names"`
+	Tags              []Coding `json:"tags"`
+	namesRe           *regexp.Regexp
+}
+
+// Regular expressions identifying codes of interest. Empty values fall back to the matching
+// environment variable.
+type ValueSetConfig struct {
+	AsthmaICD           string `json:"asthmaICD"`
+	EncounterTypeSystem string `json:"encounterTypeSystem"`
+	CSNSystem           string `json:"csnSystem"`
+	AntiAsthmatic       string `json:"antiAsthmatic"`
+	Biologic            string `json:"biologic"`
+	Controller          string `json:"controller"`
+	ICS                 string `json:"ics"`
+	ICSF                string `json:"icsf"`
+	ICSLABA             string `json:"icsLaba"`
+	SABA                string `json:"saba"`
+	Steroid             string `json:"steroid"`
+	EmergencyEncounter  string `json:"emergencyEncounter"`
+	UrgentCareEncounter string `json:"urgentCareEncounter"`
+	WellVisit           string `json:"wellVisit"`
+	InpatientEncounter  string `json:"inpatientEncounter"`
+}
+
+// Compiled value sets
+type ValueSets struct {
+	AsthmaICD           *regexp.Regexp
+	EncounterTypeSystem *regexp.Regexp
+	CSNSystem           *regexp.Regexp
+	AntiAsthmatic       *regexp.Regexp
+	Biologic            *regexp.Regexp
+	Controller          *regexp.Regexp
+	ICS                 *regexp.Regexp
+	ICSF                *regexp.Regexp
+	ICSLABA             *regexp.Regexp
+	SABA                *regexp.Regexp
+	Steroid             *regexp.Regexp
+	EmergencyEncounter  *regexp.Regexp
+	UrgentCareEncounter *regexp.Regexp
+	WellVisit           *regexp.Regexp
+	InpatientEncounter  *regexp.Regexp
 }
 
 type AsthmaActionPlanConfig struct {
@@ -127,13 +275,12 @@ func (r *ResourceReference) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	// Parse resource and ID from "ResourceType/ID"
-	if parts := strings.SplitN(temp.Reference, "/", 2); len(parts) == 2 {
-		r.ResourceType = parts[0]
-		r.Reference = parts[1]
-	}
+	// Parse resource and ID from relative ("ResourceType/ID") and absolute references. Others, such
+	// as contained and urn:uuid references, are left to resolveReference.
+	r.ResourceType, r.Reference, _ = fhir.ParseReference(temp.Reference)
 
 	// Build other fields
+	r.Literal = temp.Reference
 	r.Type = temp.Type
 	r.Display = temp.Display
 
@@ -148,12 +295,13 @@ func (d *Date) UnmarshalJSON(data []byte) error {
 	dateStr = dateStr[1 : len(dateStr)-1]
 
 	// Parse string
-	parsedTime, err := parseDate(dateStr)
+	parsedTime, precision, err := parseDate(dateStr)
 	if err != nil {
 		return fmt.Errorf("error parsing date: %v", err)
 	}
 
-	// Set parsed time to Date struct
+	// Set parsed time and precision to Date struct
 	d.Time = parsedTime
+	d.Precision = precision
 	return nil
 }
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func orderSelect(c echo.Context) error {
+	// Record the request outcome once the response has been built. Any early return is an error.
+	start := time.Now()
+	outcome := outcomeError
+	var tenant string
+	defer func() {
+		observeHook(tenant, "order-select", outcome, start)
+	}()
+
+	// Obtains raw http request
+	r := c.Request()
+
+	// Obtains http request context
+	ctx := r.Context()
+
+	hookRequest, err := parseCDSHooksRequest(r.Body)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Initialize eligibility request struct
+	er, err := newEligibilityRequest(c, hookRequest)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusForbidden)
+	}
+	tenant = er.Config.Name
+	ctx = er.Context.RequestContext
+
+	// Parse draft orders
+	drafts, err := parseDraftOrders(hookRequest.Context.DraftOrders)
+	if err != nil {
+		logger(ctx, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	// Build basic Hook response
+	hook := Hook{
+		Cards:         []Card{},
+		SystemActions: []SystemActions{},
+	}
+
+	// Only continue if the clinician is ordering a separate ICS and SABA
+	ics, saba := er.separateICSAndSABA(drafts, hookRequest.Context.Selections)
+	if len(ics) == 0 || len(saba) == 0 {
+		outcome = outcomeNotApplicable
+		return c.JSON(http.StatusOK, hook)
+	}
+
+	// Get patient data
+	if err := er.getData(er.Headers); err != nil {
+		// Reporting of errors is handled in the individual functions so no further reporting done here.
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Evaluate asthma registry and SMART criteria
+	er.evaluate()
+
+	outcome = outcomeNotInRegistry
+	if er.Criteria.AsthmaRegistry.Evaluation {
+		outcome = outcomeNotEligible
+
+		// Patient meets criteria, suggest replacing the separate orders with SMART
+		if er.eligibleForSmart() {
+			// SMART is contraindicated by an allergy
+			if er.Suppression = er.contraindicated(); er.Suppression != "" {
+				outcome = outcomeSuppressed
+				er.sendWebLog("order-select: SMART not suggested")
+				return c.JSON(http.StatusOK, hook)
+			}
+
+			hook.addSmartSwapCard(er, append(ics, saba...))
+			hook.annotateContraindications(0, er.Criteria.Contraindications)
+			hook.registerCards("order-select", er)
+			er.sendWebLog(fmt.Sprintf("order-select: suggested SMART in place of %d draft orders", len(ics)+len(saba)))
+			outcome = outcomeCardShown
+		}
+	}
+
+	// Return response
+	return c.JSON(http.StatusOK, hook)
+}
+
+func orderSign(c echo.Context) error {
+	// Record the request outcome once the response has been built. Any early return is an error.
+	start := time.Now()
+	outcome := outcomeError
+	var tenant string
+	defer func() {
+		observeHook(tenant, "order-sign", outcome, start)
+	}()
+
+	// Obtains raw http request
+	r := c.Request()
+
+	// Obtains http request context
+	ctx := r.Context()
+
+	hookRequest, err := parseCDSHooksRequest(r.Body)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Initialize eligibility request struct. Only the patient and action plan are fetched, and only
+	// when SMART is being ordered.
+	er, err := newEligibilityRequest(c, hookRequest)
+	if err != nil {
+		logger(ctx, err)
+		return c.NoContent(http.StatusForbidden)
+	}
+	tenant = er.Config.Name
+	ctx = er.Context.RequestContext
+
+	// Parse draft orders
+	drafts, err := parseDraftOrders(hookRequest.Context.DraftOrders)
+	if err != nil {
+		logger(ctx, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	// Build basic Hook response
+	hook := Hook{
+		Cards:         []Card{},
+		SystemActions: []SystemActions{},
+	}
+
+	// Find SMART orders and those without a combined scheduled and PRN sig
+	var smart, missing []*MedicationRequest
+	for _, mr := range drafts {
+		if er.Config.Codes.ICSF.MatchString(mr.MedicationReference.VocabularyCode) {
+			smart = append(smart, mr)
+			if !hasComboSig(mr) {
+				missing = append(missing, mr)
+			}
+		}
+	}
+
+	outcome = outcomeNotApplicable
+	if len(smart) == 0 {
+		return c.JSON(http.StatusOK, hook)
+	}
+
+	if len(missing) > 0 {
+		hook.addComboSigCard(missing)
+		er.sendWebLog(fmt.Sprintf("order-sign: %d SMART orders without a combined sig", len(missing)))
+	}
+
+	// SMART is being started. Offer a draft action plan if the current plan doesn't include SMART.
+	// Reporting of fetch errors is handled in the individual functions, and the sig check still applies.
+	if err := er.getActionPlanData(); err == nil && !er.actionPlanHasSmart() {
+		plan := er.actionPlan(er.Config.language(), medicationName(smart[0]), er.recommendDose(medicationCodes(smart[0])...))
+		if err := hook.addActionPlanCard(er, plan); err != nil {
+			logger(ctx, fmt.Errorf("error building action plan: %v (patient: %s)", err, er.Context.Patient.Id))
+		} else {
+			er.sendWebLog("order-sign: offered draft SMART action plan")
+		}
+	}
+
+	if len(hook.Cards) > 0 {
+		hook.registerCards("order-sign", er)
+		outcome = outcomeCardShown
+	}
+
+	// Return response
+	return c.JSON(http.StatusOK, hook)
+}
+
+// Extracts the MedicationRequests from the draftOrders Bundle of an order hook
+func parseDraftOrders(data json.RawMessage) ([]*MedicationRequest, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	// Unmarshal top-level bundle information
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("error unmarshalling draftOrders: %s", err)
+	}
+
+	var drafts []*MedicationRequest
+	for _, entry := range bundle.Entry {
+		var resource Resource
+		if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+			return nil, fmt.Errorf("failed to decode resourceType: %w", err)
+		}
+		if resource.ResourceType != "MedicationRequest" {
+			continue
+		}
+
+		var mr MedicationRequest
+		if err := json.Unmarshal(entry.Resource, &mr); err != nil {
+			return nil, fmt.Errorf("error unmarshalling MedicationRequest: %s:%s", err, string(entry.Resource))
+		}
+
+		// Draft orders carry their medication code inline
+		mr.MedicationReference.VocabularyCode = gpiCode(mr.MedicationCode.Coding)
+		drafts = append(drafts, &mr)
+	}
+
+	return drafts, nil
+}
+
+// Splits draft orders into inhaled corticosteroids (other than ICS-formoterol) and SABAs. Nothing is
+// returned unless at least one of them is among the orders the clinician just selected.
+func (er *EligibilityRequest) separateICSAndSABA(drafts []*MedicationRequest, selections []string) ([]*MedicationRequest, []*MedicationRequest) {
+	var ics, saba []*MedicationRequest
+	var selected bool
+
+	for _, mr := range drafts {
+		code := mr.MedicationReference.VocabularyCode
+		codes := er.Config.Codes
+
+		switch {
+		case codes.ICS.MatchString(code) && !codes.ICSF.MatchString(code):
+			ics = append(ics, mr)
+		case codes.SABA.MatchString(code):
+			saba = append(saba, mr)
+		default:
+			continue
+		}
+
+		if len(selections) == 0 || slices.Contains(selections, "MedicationRequest/"+mr.Id) {
+			selected = true
+		}
+	}
+
+	if !selected {
+		return nil, nil
+	}
+	return ics, saba
+}
+
+// Adds a card suggesting ICS-formoterol SMART in place of the given draft orders
+func (h *Hook) addSmartSwapCard(er *EligibilityRequest, replace []*MedicationRequest) {
+	patId := er.Context.Patient.Id
+
+	// Remove the separate ICS and SABA orders
+	var actions []Action
+	var names []string
+	for _, mr := range replace {
+		actions = append(actions, Action{
+			Type:        "delete",
+			Description: "Remove " + medicationName(mr),
+			ResourceId:  "MedicationRequest/" + mr.Id,
+		})
+		names = append(names, medicationName(mr))
+	}
+
+	// Add ICS-formoterol at the recommended dose, or the SMART order set if no medication has been
+	// configured
+	if rec := er.recommendDose(); rec != nil {
+		actions = append(actions, Action{
+			Type:        "create",
+			Description: "Order " + rec.String(),
+			Resource:    rec.medicationRequest(patId),
+		})
+	} else if med := er.Config.SmartMedication; med != nil {
+		actions = append(actions, Action{
+			Type:        "create",
+			Description: "Order " + med.Display + " as maintenance and reliever therapy",
+			Resource:    smartMedicationRequest(patId, *med),
+		})
+	} else {
+		actions = append(actions, Action{
+			Type:        "create",
+			Description: "SMART Asthma Therapy",
+			Resource:    orderSetRequest(patId, er.Config.OrderSetKey),
+		})
+	}
+
+	h.Cards = append(h.Cards, Card{
+		Summary:   "Consider SMART in place of separate ICS and SABA",
+		Indicator: "info",
+		Extension: &Extension{
+			ContentType: "text/html",
+		},
+		Detail: "<p>This patient is eligible for SMART asthma therapy. Single maintenance and reliever " +
+			"therapy with ICS-formoterol can replace the separate orders for " + template.HTMLEscapeString(strings.Join(names, " and ")) + ".</p>",
+		Source: smartSource(),
+		Suggestions: []Suggestion{
+			{
+				Label:   "Replace with ICS-formoterol SMART",
+				Actions: actions,
+			},
+		},
+	})
+}
+
+// Adds a card warning that SMART orders are missing a combined scheduled and PRN sig
+func (h *Hook) addComboSigCard(orders []*MedicationRequest) {
+	var names []string
+	for _, mr := range orders {
+		names = append(names, medicationName(mr))
+	}
+
+	h.Cards = append(h.Cards, Card{
+		Summary:   "SMART order missing maintenance and reliever sig",
+		Indicator: "warning",
+		Extension: &Extension{
+			ContentType: "text/html",
+		},
+		Detail: "<p>" + template.HTMLEscapeString(strings.Join(names, ", ")) + " should include both a scheduled (maintenance) and an " +
+			"as needed (reliever) dosage instruction for SMART asthma therapy.</p>",
+		Source: smartSource(),
+	})
+}
+
+// Builds a draft ICS-formoterol order with a combined maintenance and reliever sig
+func smartMedicationRequest(patId string, med Coding) MedicationRequestAction {
+	return MedicationRequestAction{
+		ResourceType: "MedicationRequest",
+		Status:       "draft",
+		Intent:       "proposal",
+		Category: []Category{
+			{
+				Coding: []Coding{
+					{
+						System:  "http://terminology.hl7.org/CodeSystem/medicationrequest-category",
+						Code:    "outpatient",
+						Display: "Outpatient",
+					},
+				},
+			},
+		},
+		MedicationCodeableConcept: Category{
+			Coding: []Coding{med},
+			Text:   med.Display,
+		},
+		Subject: ResourceReference{
+			Reference: fmt.Sprintf("Patient/%s", patId),
+		},
+		DosageInstruction: []DosageAction{
+			{Text: "Maintenance: inhale as scheduled", AsNeededBoolean: false},
+			{Text: "Reliever: inhale as needed for asthma symptoms", AsNeededBoolean: true},
+		},
+	}
+}
+
+// Source shared by SMART Asthma cards
+func smartSource() Source {
+	return Source{
+		Label: "SMART Asthma Service",
+		Topic: &Coding{
+			Code: fmt.Sprintf("SMARTAsthma%s", time.Now().Format("20060102150405")),
+		},
+	}
+}
+
+// Returns the codes identifying the medication of an order
+func medicationCodes(mr *MedicationRequest) []string {
+	var codes []string
+	if mr.MedicationReference.VocabularyCode != "" {
+		codes = append(codes, mr.MedicationReference.VocabularyCode)
+	}
+	for _, coding := range mr.MedicationCode.Coding {
+		codes = append(codes, coding.Code)
+	}
+	return codes
+}
+
+// Returns a display name for an order
+func medicationName(mr *MedicationRequest) string {
+	if mr.MedicationCode.Text != "" {
+		return mr.MedicationCode.Text
+	}
+	for _, code := range mr.MedicationCode.Coding {
+		if code.Display != "" {
+			return code.Display
+		}
+	}
+	if mr.MedicationReference.Display != "" {
+		return mr.MedicationReference.Display
+	}
+	return "MedicationRequest/" + mr.Id
+}
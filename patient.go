@@ -2,25 +2,27 @@ package main
 
 import (
 	"sync"
-
-	"go.elastic.co/apm"
 )
 
 type Patient struct {
-	ResourceType     string       `json:"resourcetype"`
-	Id               string       `json:"id"`
-	Identifier       []Identifier `json:"identifier"`
-	Deceased         bool         `json:"deceasedBoolean"`
-	DeceasedDateTime string       `json:"deceasedDateTime"`
-	BirthDate        Date         `json:"birthDate"`
-	MRN              string
+	ResourceType string `json:"resourcetype"`
+	Id           string `json:"id"`
+	Meta         struct {
+		Tag []Coding `json:"tag"`
+	} `json:"meta"`
+	Identifier          []Identifier        `json:"identifier"`
+	Name                []HumanName         `json:"name"`
+	Deceased            Deceased            `json:"-"`
+	BirthDate           Date                `json:"birthDate"`
+	GeneralPractitioner []ResourceReference `json:"generalPractitioner"`
+	MRN                 string
 }
 
 func (er *EligibilityRequest) getPatient(wg *sync.WaitGroup, errCh chan<- error, headers map[string]string) {
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Patient")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Patient")
 	defer span.End()
 
 	// Construct request and add to list
@@ -34,7 +36,7 @@ func (er *EligibilityRequest) getPatient(wg *sync.WaitGroup, errCh chan<- error,
 	}
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+type CareTeam struct {
+	ResourceType string     `json:"resourcetype"`
+	Id           string     `json:"id"`
+	Status       string     `json:"status"`
+	Category     []Category `json:"category"`
+	Participant  []struct {
+		Role   []Category        `json:"role"`
+		Member ResourceReference `json:"member"`
+	} `json:"participant"`
+	ManagingOrganization []ResourceReference `json:"managingOrganization"`
+}
+
+// Gets the patient's care teams, if the tenant attributes primary care by care team
+func (er *EligibilityRequest) getCareTeams(wg *sync.WaitGroup, errCh chan<- error, headers map[string]string) {
+	defer wg.Done()
+
+	if er.Config.PrimaryCare == nil || !er.Config.PrimaryCare.CareTeam {
+		errCh <- nil
+		return
+	}
+
+	// Create span
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Care Teams")
+	defer span.End()
+
+	// Initialize query parameters
+	queryParams := url.Values{}
+	queryParams.Add("patient", er.Context.Patient.Id)
+	queryParams.Add("status", "active")
+
+	// Construct request and add to list
+	requestList := []Request{
+		{
+			Method:      "GET",
+			URL:         er.Host + "/CareTeam",
+			QueryParams: queryParams,
+			Body:        nil,
+		},
+	}
+
+	// Send requests and process responses
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
+		errCh <- err
+		return
+	}
+
+	errCh <- nil
+}
+
+// Compiles the pattern identifying the tenant's primary care practices
+func (p *PrimaryCareConfig) compile() error {
+	var err error
+	p.practicesRe, err = regexp.Compile(p.Practices)
+	return err
+}
+
+// Reports whether a reference is to one of the tenant's primary care practices
+func (p *PrimaryCareConfig) isPractice(ref ResourceReference) bool {
+	if ref.Reference == "" && ref.Display == "" {
+		return false
+	}
+	return p.practicesRe.MatchString(ref.Reference) || p.practicesRe.MatchString(ref.Display)
+}
+
+// Determines whether the patient was attributed to primary care at the start of the month, by a
+// well visit at a primary care practice, an assigned primary care provider or a primary care team.
+// Tenants without primary care attribution rely on the EHR to limit the patients evaluated.
+func (er *EligibilityRequest) primaryCare() bool {
+	pc := er.Config.PrimaryCare
+	if pc == nil {
+		return true
+	}
+
+	// Check for a well visit in the months before the start of the month
+	if pc.WellVisitMonths > 0 {
+		now := clinicalNow()
+		startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		lookback := startOfMonth.AddDate(0, -pc.WellVisitMonths, 0)
+
+		for _, encounter := range er.Data.Encounters {
+			start := encounter.Period.Start.Time
+			if encounter.Status == "cancelled" || encounter.Status == "noshow" {
+				continue
+			}
+			if start.Before(lookback) || !start.Before(startOfMonth) {
+				continue
+			}
+			if encounter.matches(er.Config.Codes.WellVisit) && (pc.Practices == "" || pc.isPractice(encounter.ServiceProvider)) {
+				return true
+			}
+		}
+	}
+
+	// Check for an assigned primary care provider
+	if pc.GeneralPractitioner {
+		for _, gp := range er.Context.Patient.GeneralPractitioner {
+			if pc.isPractice(gp) {
+				return true
+			}
+		}
+	}
+
+	// Check for an active primary care team
+	if pc.CareTeam {
+		for _, team := range er.Data.CareTeams {
+			if team.Status != "" && team.Status != "active" {
+				continue
+			}
+			for _, org := range team.ManagingOrganization {
+				if pc.isPractice(org) {
+					return true
+				}
+			}
+			for _, participant := range team.Participant {
+				if pc.isPractice(participant.Member) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
@@ -4,9 +4,8 @@ import (
 	"net/url"
 	"strings"
 	"sync"
-	"time"
 
-	"go.elastic.co/apm"
+	"github.com/chop-dbhi/smart-asthma/fhir"
 )
 
 type Condition struct {
@@ -23,6 +22,7 @@ type Condition struct {
 		Coding []Coding `json:"coding"`
 	} `json:"code"`
 	EncounterReference ResourceReference `json:"encounter"`
+	Onset              Onset             `json:"-"`
 }
 
 type List struct {
@@ -33,13 +33,16 @@ type List struct {
 	Entry              []struct {
 		Item ResourceReference `json:"item"`
 	} `json:"entry"`
+
+	// Contained resources, such as a contained Medication or Condition
+	Contained []fhir.RawResource `json:"contained"`
 }
 
 func (er *EligibilityRequest) getProblemList(wg *sync.WaitGroup, errCh chan<- error, headers map[string]string) {
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Problems")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Problems")
 	defer span.End()
 
 	// Initialize query parameters
@@ -58,7 +61,7 @@ func (er *EligibilityRequest) getProblemList(wg *sync.WaitGroup, errCh chan<- er
 	}
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -70,7 +73,7 @@ func (er *EligibilityRequest) getHospitalProblemList(wg *sync.WaitGroup, errCh c
 	defer wg.Done()
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Hospital Problems")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "Hospital Problems")
 	defer span.End()
 
 	// Initialize query parameters
@@ -89,7 +92,7 @@ func (er *EligibilityRequest) getHospitalProblemList(wg *sync.WaitGroup, errCh c
 	}
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		errCh <- err
 		return
 	}
@@ -100,7 +103,7 @@ func (er *EligibilityRequest) getHospitalProblemList(wg *sync.WaitGroup, errCh c
 func (er *EligibilityRequest) getEncounterDiagnoses(encounterList []string, headers map[string]string) error {
 
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "EncounterDiagnosis")
+	span, ctx := startSpan(er.Context.RequestContext, "Get and Parse Data", "EncounterDiagnosis")
 	defer span.End()
 
 	// Initialize a request list
@@ -126,7 +129,7 @@ func (er *EligibilityRequest) getEncounterDiagnoses(encounterList []string, head
 	}
 
 	// Send requests and process responses
-	if err := er.sendAndProcess(requestList, headers); err != nil {
+	if err := er.sendAndProcess(ctx, requestList, headers); err != nil {
 		return err
 	}
 
@@ -143,25 +146,31 @@ func (er *EligibilityRequest) processProblems() {
 	// Create data shortcut
 	data := er.Data
 
+	// Index the patient's problem list by ID
+	conditions := map[string]*Condition{}
+	for _, condition := range data.ProblemList {
+		conditions[condition.Id] = condition
+	}
+
+	// Add the conditions on hospital problem lists to hospital problems. Required since the hospital
+	// problem list resource only includes references to conditions, not the actual conditions
+	// themselves, unless they are contained.
+	for _, hospitalProblem := range data.HospitalProblemList {
+		for _, entry := range hospitalProblem.Entry {
+			if condition, ok := er.referencedCondition(hospitalProblem, entry.Item, conditions); ok {
+				data.HospitalProblems = append(data.HospitalProblems, condition)
+			}
+		}
+	}
+
 	// Create a filtered slice based on the existing problem slice, re-using memory
 	filtered := data.ProblemList[:0]
 
-	// Iterate over the patient's problem list
+	// Keep the conditions in the "ProblemList" struct, if active
 	for _, condition := range data.ProblemList {
-		// Keep the condition in the "ProblemList" struct, if active
 		if condition.ClinicalStatus.Text == "Active" {
 			filtered = append(filtered, condition)
 		}
-		// Check if the problem was incldued as a hospital problem, if so, add to hospital problems list
-		// Required since the hospital problem list resource only includes references to conditions, not
-		// the actual conditions themselves.
-		for _, hospitalProblem := range data.HospitalProblemList {
-			for _, entry := range hospitalProblem.Entry {
-				if entry.Item.Reference == condition.Id {
-					data.HospitalProblems = append(data.HospitalProblems, condition)
-				}
-			}
-		}
 	}
 
 	// Replace problem list with filtered list (e.g. active problems)
@@ -171,7 +180,7 @@ func (er *EligibilityRequest) processProblems() {
 func (er *EligibilityRequest) filterHospitalProblemsByTime(list []*Condition, lookback int) []*Condition {
 
 	// Initialize date values
-	today := time.Now()
+	today := clinicalNow()
 	lookbackDate := today.AddDate(0, 0, lookback)
 
 	// Create a filtered slice based on the existing problem slice, re-using memory
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chop-dbhi/smart-asthma/fhir"
+)
+
+// Records a Bundle entry's full URL, so references to the entry can be resolved. Entries without
+// an ID, such as those in transaction Bundles, are identified by their full URL.
+func (er *EligibilityRequest) recordFullURL(fullURL string, data []byte) {
+	if fullURL == "" {
+		return
+	}
+
+	var resource struct {
+		ResourceType string `json:"resourceType"`
+		Id           string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &resource); err != nil || resource.ResourceType == "" {
+		return
+	}
+	if resource.Id == "" {
+		resource.Id = fullURL
+	}
+
+	er.Maps.FullURL[fullURL] = resource.ResourceType + "/" + resource.Id
+}
+
+// Resolves a reference to the type and ID of the resource it points to. Relative and absolute
+// references resolve directly, and Bundle full URLs (including urn:uuid) through the entries seen.
+// Contained references (#id) return the ID within the referencing resource. References that cannot
+// be resolved return an empty ID.
+func (er *EligibilityRequest) resolveReference(ref ResourceReference) (resourceType, id string, contained bool) {
+	switch {
+	case ref.Literal == "":
+		// Built in code rather than decoded
+		return ref.ResourceType, ref.Reference, false
+
+	case strings.HasPrefix(ref.Literal, "#"):
+		return ref.Type, strings.TrimPrefix(ref.Literal, "#"), true
+	}
+
+	// Check for a Bundle entry's full URL
+	if key, ok := er.Maps.FullURL[ref.Literal]; ok {
+		resourceType, id, _ = strings.Cut(key, "/")
+		return resourceType, id, false
+	}
+
+	// Fall back to the type and ID in the URL
+	if resourceType, id, ok := fhir.ParseReference(ref.Literal); ok {
+		return resourceType, id, false
+	}
+	return ref.Type, "", false
+}
+
+// Returns the Medication a MedicationRequest refers to, whether contained in the request or fetched
+// separately
+func (er *EligibilityRequest) referencedMedication(mr *MedicationRequest) (*Medication, bool) {
+	_, id, contained := er.resolveReference(mr.MedicationReference.ResourceReference)
+	if id == "" {
+		return nil, false
+	}
+	if !contained {
+		med, ok := er.Data.Medications[id]
+		return med, ok
+	}
+
+	var med Medication
+	if err := decodeContained(mr.Contained, id, &med); err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+		return nil, false
+	}
+	return &med, true
+}
+
+// Returns the Condition a List entry refers to, whether contained in the List or on the problem list
+func (er *EligibilityRequest) referencedCondition(list *List, ref ResourceReference, conditions map[string]*Condition) (*Condition, bool) {
+	_, id, contained := er.resolveReference(ref)
+	if id == "" {
+		return nil, false
+	}
+	if !contained {
+		condition, ok := conditions[id]
+		return condition, ok
+	}
+
+	var condition Condition
+	if err := decodeContained(list.Contained, id, &condition); err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("%v (patient: %s)", err, er.Context.Patient.Id))
+		return nil, false
+	}
+	return &condition, true
+}
+
+// Decodes one of a resource's contained resources
+func decodeContained(contained []fhir.RawResource, id string, v any) error {
+	for _, raw := range contained {
+		if _, rid := raw.Header(); rid != id {
+			continue
+		}
+		if err := raw.Decode(v); err != nil {
+			return fmt.Errorf("error unmarshalling contained resource #%s: %s", id, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("contained resource #%s not found", id)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Server settings. Timeouts are in seconds. WRITE_TIMEOUT should exceed TIMEOUT, so evaluations
+// that wait on the FHIR server can still respond.
+var (
+	listenAddr      string = getEnv("LISTEN_ADDR", ":8000")
+	readTimeout     int    = getEnvInt("READ_TIMEOUT", 30)
+	writeTimeout    int    = getEnvInt("WRITE_TIMEOUT", 60)
+	idleTimeout     int    = getEnvInt("IDLE_TIMEOUT", 120)
+	bodyLimit       string = getEnv("BODY_LIMIT", "4M")
+	shutdownDelay   int    = getEnvInt("SHUTDOWN_DELAY", 0)
+	shutdownTimeout int    = getEnvInt("SHUTDOWN_TIMEOUT", 30)
+
+	// TLS is enabled when a certificate and key are set. A client CA enables mutual TLS.
+	tlsCertFile     string = os.Getenv("TLS_CERT_FILE")
+	tlsKeyFile      string = os.Getenv("TLS_KEY_FILE")
+	tlsClientCAFile string = os.Getenv("TLS_CLIENT_CA_FILE")
+	tlsClientAuth   string = getEnv("TLS_CLIENT_AUTH", "require")
+)
+
+// Hooks being evaluated, tracked so shutdown can wait for them
+var hooks inFlight
+
+// Counts in-flight requests and refuses new ones once draining
+type inFlight struct {
+	mu       sync.Mutex
+	count    int
+	draining bool
+	idle     chan struct{}
+}
+
+// Middleware tracking hook requests. Evaluations and writebacks run within the request, so waiting
+// for the request also waits for them, even when the client has disconnected.
+func (f *inFlight) track(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !f.start() {
+			return c.NoContent(http.StatusServiceUnavailable)
+		}
+		defer f.done()
+		return next(c)
+	}
+}
+
+func (f *inFlight) start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return false
+	}
+	f.count++
+	return true
+}
+
+func (f *inFlight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count--
+	if f.count == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// Stops accepting new requests
+func (f *inFlight) drain() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.draining = true
+}
+
+// Reports whether new requests are refused
+func (f *inFlight) Draining() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.draining
+}
+
+// Waits for in-flight requests to finish
+func (f *inFlight) wait(ctx context.Context) error {
+	f.mu.Lock()
+	if f.count == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle, count := f.idle, f.count
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown with %d hooks in flight: %w", count, ctx.Err())
+	}
+}
+
+// Configures the HTTP server, with TLS if a certificate is set
+func configureServer(s *http.Server) error {
+	s.Addr = listenAddr
+	s.ReadTimeout = time.Duration(readTimeout) * time.Second
+	s.ReadHeaderTimeout = time.Duration(readTimeout) * time.Second
+	s.WriteTimeout = time.Duration(writeTimeout) * time.Second
+	s.IdleTimeout = time.Duration(idleTimeout) * time.Second
+
+	if tlsCertFile == "" && tlsKeyFile == "" {
+		if tlsClientCAFile != "" {
+			return fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil
+	}
+
+	if tlsClientAuth != "require" && tlsClientAuth != "verify-if-given" {
+		return fmt.Errorf("TLS_CLIENT_AUTH must be require or verify-if-given, got %q", tlsClientAuth)
+	}
+	if err := certs.load(); err != nil {
+		return err
+	}
+	s.TLSConfig = certs.tlsConfig()
+	return nil
+}
+
+// Certificates, reloaded when the files change or on SIGHUP
+var certs certReloader
+
+type certReloader struct {
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+}
+
+// Reads the certificate, key and client CAs
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if tlsClientCAFile != "" {
+		pem, err := os.ReadFile(tlsClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in TLS client CA %s", tlsClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTime = r.latestModTime()
+	return nil
+}
+
+// Returns a TLS config that reads the current certificates for each connection
+func (r *certReloader) tlsConfig() *tls.Config {
+	config := func() *tls.Config {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		c := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*r.cert},
+		}
+		if r.clientCAs != nil {
+			c.ClientCAs = r.clientCAs
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+			if tlsClientAuth == "verify-if-given" {
+				c.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+		}
+		return c
+	}
+
+	base := config()
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return config(), nil
+	}
+	return base
+}
+
+// Reloads the certificates on SIGHUP or when a file changes. A failed reload keeps the current ones.
+func (r *certReloader) watch(stop <-chan struct{}) {
+	if tlsCertFile == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(time.Duration(configWatchInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			r.mu.RLock()
+			changed := !r.latestModTime().Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+		case <-stop:
+			return
+		}
+
+		if err := r.load(); err != nil {
+			zapLogger.Error(fmt.Sprintf("certificate reload failed, keeping current certificate: %v", err))
+
+			// Wait for the next change before trying again
+			r.mu.Lock()
+			r.modTime = r.latestModTime()
+			r.mu.Unlock()
+			continue
+		}
+		zapLogger.Info("TLS certificate reloaded")
+	}
+}
+
+// Returns the latest modification time of the certificate files
+func (r *certReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, path := range []string{tlsCertFile, tlsKeyFile, tlsClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			latest = maxTime(latest, info.ModTime())
+		}
+	}
+	return latest
+}
@@ -6,6 +6,7 @@ import (
 
 type SmartEligibleCriteria struct {
 	Age               bool
+	PrimaryCare       bool
 	Biologic365       bool
 	CCC               bool
 	Controller30Days  bool
@@ -14,6 +15,7 @@ type SmartEligibleCriteria struct {
 	SCSEpisode365     bool
 	SCSDates          []time.Time
 	UncontrolledACT   bool
+	Adherent          bool
 	Evaluation        bool
 }
 
@@ -28,14 +30,16 @@ type SmartInitiatedCriteria struct {
 func (er *EligibilityRequest) smartEligible() *SmartEligibleCriteria {
 	/*
 	 * Age 5-18 years
-	 * AND Active at start of month in Primary Care Wellness Registry
+	 * AND Active at start of month in Primary Care Wellness Registry (well visit, primary care provider or
+	 *   care team, if configured; otherwise handled by EHR configuration)
 	 * AND Active in Asthma Registry (defined based on asthma_criteria.go). Always true if this function is evaluated.
 	 * AND NOT Biologic order in previous 365 days
 	 * AND < 3 complex chronic conditions (Chen to provide simple approach to capture this)
 	 * AND ICS/L order in previous 365 days
+	 * AND ICS/L proportion of days covered at or above the tenant's minimum, if set
 	 * AND (
 	 *   (
-	 *     2 SCS prescribing episodes (defined as orders >= 14 days apart) in previous 365 days
+	 *     2 SCS prescribing episodes (defined as orders > 14 days apart, configurable per tenant) in previous 365 days
 	 *     AND >= 1 SCS order in the last 183 days at least 30 days after most recent ICS/L
 	 *   )
 	 *	 OR Uncontrolled Asthma Control Tool response in previous 183 days at least 30 days after most recent ICS/L
@@ -48,7 +52,7 @@ func (er *EligibilityRequest) smartEligible() *SmartEligibleCriteria {
 	 */
 
 	// Set date values
-	today := time.Now()
+	today := clinicalNow()
 	oneMonthLookback := today.AddDate(0, 0, -30)
 	sixMonthLookback := today.AddDate(0, 0, -183)
 
@@ -61,23 +65,34 @@ func (er *EligibilityRequest) smartEligible() *SmartEligibleCriteria {
 		sec.Age = true
 	}
 
-	// Check for at least two SCS courses
-	er.Data.SteroidCourses = groupEvents(er.Data.SteroidMedicationRequests, 14, func(mr *MedicationRequest) time.Time {
-		return mr.AuthoredOn.Time
-	}, false)
+	// Check primary care attribution
+	sec.PrimaryCare = er.primaryCare()
+
+	// Check for at least two SCS courses, or exacerbations when acute care is included. Courses
+	// and exacerbations have been grouped most recent first, so each date is the latest of one.
+	// Encounters are fetched for two years, so only exacerbations in the past year count.
+	var episodes []time.Time
+	if er.Config.includeAcuteCare() {
+		for _, e := range er.exacerbationsSince(365) {
+			episodes = append(episodes, e.End)
+		}
+	} else {
+		for _, course := range er.Data.SteroidCourses {
+			episodes = append(episodes, course[0].AuthoredOn.Time)
+		}
+	}
 SCSCourseLoop:
-	for i := len(er.Data.SteroidCourses) - 1; i >= 0; i-- {
-		scsCourse := er.Data.SteroidCourses[i]
+	for i := len(episodes) - 1; i >= 0; i-- {
 		// Check for oder within past 6 months
 		if !sec.SCS183 {
-			if isAfterDay(scsCourse[0].AuthoredOn.Time, sixMonthLookback) {
+			if isAfterDay(episodes[i], sixMonthLookback) {
 				sec.SCS183 = true
 			}
 		}
 
 		// Add order dates to list, which will be displayed in UI
-		sec.SCSDates = append(sec.SCSDates, scsCourse[0].AuthoredOn.Time)
-		if len(er.Data.SteroidCourses)-i >= 2 {
+		sec.SCSDates = append(sec.SCSDates, episodes[i])
+		if len(episodes)-i >= 2 {
 			sec.SCSEpisode365 = true
 			break SCSCourseLoop
 		}
@@ -109,8 +124,12 @@ ControllerOrderLoop:
 		}
 	}
 
+	// Check controller adherence meets the tenant's minimum, so non-adherence isn't taken for
+	// uncontrolled asthma
+	sec.Adherent = er.adherent()
+
 	// Return final evaluation
-	sec.Evaluation = sec.Age && !sec.Biologic365 && !sec.Controller30Days && sec.Controller365Days && !sec.CCC && ((sec.SCSEpisode365 && sec.SCS183) || sec.UncontrolledACT)
+	sec.Evaluation = sec.Age && sec.PrimaryCare && !sec.Biologic365 && !sec.Controller30Days && sec.Controller365Days && !sec.CCC && sec.Adherent && ((sec.SCSEpisode365 && sec.SCS183) || sec.UncontrolledACT)
 
 	return &sec
 }
@@ -135,7 +154,7 @@ func (er *EligibilityRequest) smartInitiated() *SmartInitiatedCriteria {
 	 */
 
 	// Set date values
-	today := time.Now()
+	today := clinicalNow()
 
 	// Evaluate smart eligible criteria
 	sic := SmartInitiatedCriteria{}
@@ -152,35 +171,39 @@ func (er *EligibilityRequest) smartInitiated() *SmartInitiatedCriteria {
 		mr := er.Data.ControllerMedicationRequests[0]
 
 		// Evaluate medication
-		if icsfRegex.MatchString(mr.MedicationReference.VocabularyCode) {
+		if er.Config.Codes.ICSF.MatchString(mr.MedicationReference.VocabularyCode) {
 			// Medication is an ICS-Formoterol
 			sic.ICSF = true
 
 			// Check for combination dose/signature, based on a PRN and scheduled dosage instruction
-			if len(mr.DosageInstruction) == 2 {
-				if mr.DosageInstruction[0].AsNeeded != mr.DosageInstruction[1].AsNeeded {
-					sic.ComboSig = true
-				}
-			}
+			sic.ComboSig = hasComboSig(mr)
 		}
 	}
 
-AsthmaActionPlanLoop:
-	// Check for SMART medications across green and yellow zone of asthma action plan using IDs provided
-	// by the health care organization
-	// NOTE: This does not verify whether medication in plan is the same as the latest order
+	// Check for SMART medications across green and yellow zone of asthma action plan
+	sic.AAP = er.actionPlanHasSmart()
+
+	// Return final evaluation
+	sic.Evaluation = sic.Age && sic.ICSF && (sic.ComboSig || sic.AAP)
+
+	return &sic
+}
+
+// Reports whether the asthma action plan has a SMART medication in the green zone and its matching
+// medication in the yellow zone, using IDs provided by the health care organization
+// NOTE: This does not verify whether medication in plan is the same as the latest order
+func (er *EligibilityRequest) actionPlanHasSmart() bool {
 	for _, gzo := range er.Data.AsthmaActionPlan.GreenZone {
 		for _, gz_component := range gzo.Component {
 			for _, gz_coding := range gz_component.ValueCodeableConcept.Coding {
-				yz_codes, ok := config.AsthmaActionPlan.MedicationMap[gz_coding.Code]
+				yz_codes, ok := er.Config.AsthmaActionPlan.MedicationMap[gz_coding.Code]
 				if ok {
 					for _, yzo := range er.Data.AsthmaActionPlan.YellowZone {
 						for _, yz_component := range yzo.Component {
 							for _, yz_coding := range yz_component.ValueCodeableConcept.Coding {
 								for _, yz_code := range yz_codes {
 									if yz_coding.Code == yz_code {
-										sic.AAP = true
-										break AsthmaActionPlanLoop
+										return true
 									}
 								}
 							}
@@ -191,8 +214,5 @@ AsthmaActionPlanLoop:
 		}
 	}
 
-	// Return final evaluation
-	sic.Evaluation = sic.Age && sic.ICSF && (sic.ComboSig || sic.AAP)
-
-	return &sic
+	return false
 }
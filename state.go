@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-
-	"go.elastic.co/apm"
 )
 
 // Request body to store data to the EHR
@@ -32,7 +30,7 @@ type SmartDataValues struct {
 
 func (er *EligibilityRequest) saveState(location, value string, headers map[string]string) error {
 	// Create span
-	span, _ := apm.StartSpan(er.Context.RequestContext, "Get and Parse Data", "Save Data")
+	span, ctx := startSpan(er.Context.RequestContext, "Save Data", "SmartData")
 	defer span.End()
 
 	// Remove FHIR path from host
@@ -48,7 +46,7 @@ func (er *EligibilityRequest) saveState(location, value string, headers map[stri
 		EntityIDType:  "FHIR",
 		ContactID:     er.Context.Encounter["csn"],
 		ContactIDType: "CSN",
-		UserID:        config.SystemUser,
+		UserID:        er.Config.SystemUser,
 		UserIDType:    "FHIR",
 		Source:        "SMART Asthma Service",
 		SmartDataValues: []SmartDataValues{
@@ -75,7 +73,7 @@ func (er *EligibilityRequest) saveState(location, value string, headers map[stri
 	url += "/epic/2013/Clinical/Utility/SETSMARTDATAVALUES/SmartData/Values"
 
 	// Get encounter location
-	resp, err := sendRequest(http.MethodPut, url, nil, headers, bytes.NewReader(bodyReader))
+	resp, err := sendRequest(ctx, http.MethodPut, url, nil, headers, bytes.NewReader(bodyReader))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	storePath string = getEnv("STORE_PATH", "smart-asthma.db")
+	store     *bolt.DB
+)
+
+const (
+	// Cards returned to the EHR, keyed by card UUID
+	cardBucket string = "cards"
+
+	// CDS Hooks feedback, keyed by card UUID and time received
+	feedbackBucket string = "feedback"
+
+	// Card snoozes and frequency caps, keyed by tenant, service, patient and optionally user
+	suppressionBucket string = "suppression"
+
+	// Evaluation snapshots, keyed by tenant, patient and time evaluated
+	historyBucket string = "history"
+)
+
+// Opens the local store and creates any missing buckets
+func openStore() error {
+	var err error
+	store, err = bolt.Open(storePath, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("error opening store %s: %v", storePath, err)
+	}
+
+	return store.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{cardBucket, feedbackBucket, suppressionBucket, historyBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func closeStore() error {
+	if store == nil {
+		return nil
+	}
+	return store.Close()
+}
+
+// Stores a value as JSON
+func putJSON(bucket, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), data)
+	})
+}
+
+// Reads a JSON value. Reports false if the key does not exist.
+func getJSON(bucket, key string, value any) (bool, error) {
+	var data []byte
+	err := store.View(func(tx *bolt.Tx) error {
+		// Copy the value since it is only valid during the transaction
+		if v := tx.Bucket([]byte(bucket)).Get([]byte(key)); v != nil {
+			data = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// Calls fn with the raw JSON of every value whose key starts with prefix
+func scanJSON(bucket, prefix string, fn func(key string, data []byte) error) error {
+	return store.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		p := []byte(prefix)
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if err := fn(string(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Override reason that snoozes a card when no snoozes are configured
+const snoozeReasonCode string = "remind-30-days"
+
+// Card suppression state for a patient, or a patient and user
+type SuppressionRecord struct {
+	Evidence     string      `json:"evidence"`
+	Shown        []time.Time `json:"shown"`
+	SnoozedUntil time.Time   `json:"snoozedUntil,omitempty"`
+	SnoozeReason string      `json:"snoozeReason,omitempty"`
+}
+
+// Returns the days each override reason snoozes a card for
+func (c *Config) snoozeDays() map[string]int {
+	if c.Suppression != nil && c.Suppression.SnoozeDays != nil {
+		return c.Suppression.SnoozeDays
+	}
+	return map[string]int{snoozeReasonCode: 30}
+}
+
+// Key of the suppression record for a card. Suppression is per patient unless the tenant tracks it
+// per user.
+func suppressionKey(config *Config, service, patientId, userId string) string {
+	parts := []string{config.Name, service, patientId}
+	if config.Suppression != nil && config.Suppression.PerUser {
+		parts = append(parts, userId)
+	}
+	return strings.Join(parts, "|")
+}
+
+// Summarizes the evidence behind an eligibility card. A change in evidence resets any snooze or
+// frequency cap so new events are always shown.
+func (er *EligibilityRequest) evidence() string {
+	var parts []string
+
+	// Start of the most recent SCS course. Courses are sorted most recent first.
+	if courses := er.Data.SteroidCourses; len(courses) > 0 {
+		course := courses[0]
+		parts = append(parts, "scs:"+course[len(course)-1].AuthoredOn.Format(time.DateOnly))
+	}
+
+	// Most recent uncontrolled Asthma Control Tool
+	if er.Data.AsthmaControlTool.Status >= 2 {
+		parts = append(parts, "act:"+er.Data.AsthmaControlTool.Date.Format(time.RFC3339))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Returns the reason a card should not be shown, or an empty string if it should be. Errors reading
+// the store are logged and the card is shown.
+func (er *EligibilityRequest) suppression(service string) string {
+	key := suppressionKey(er.Config, service, er.Context.Patient.Id, er.Context.User)
+
+	var record SuppressionRecord
+	found, err := getJSON(suppressionBucket, key, &record)
+	if err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("failed to read suppression for %s: %v (patient: %s)", service, err, er.Context.Patient.Id))
+		return ""
+	}
+
+	// Nothing recorded yet, or the evidence has changed since the card was last shown
+	if !found || record.Evidence != er.evidence() {
+		return ""
+	}
+
+	now := time.Now()
+	if now.Before(record.SnoozedUntil) {
+		return fmt.Sprintf("snoozed until %s (%s)", record.SnoozedUntil.Format(time.DateOnly), record.SnoozeReason)
+	}
+
+	// Check how often the card has been shown recently
+	limit := er.Config.Suppression
+	if limit == nil || limit.MaxCards <= 0 {
+		return ""
+	}
+	since := now.AddDate(0, 0, -limit.IntervalDays)
+	var shown int
+	for _, t := range record.Shown {
+		if t.After(since) {
+			shown++
+		}
+	}
+	if shown >= limit.MaxCards {
+		return fmt.Sprintf("frequency cap: shown %d times in the last %d days", shown, limit.IntervalDays)
+	}
+
+	return ""
+}
+
+// Records that a card was shown, resetting the record when the evidence has changed
+func (er *EligibilityRequest) recordShown(service string) {
+	key := suppressionKey(er.Config, service, er.Context.Patient.Id, er.Context.User)
+	evidence := er.evidence()
+
+	// Only keep as much history as the frequency cap needs
+	since := time.Now().AddDate(0, 0, -365)
+	if limit := er.Config.Suppression; limit != nil && limit.IntervalDays > 0 {
+		since = time.Now().AddDate(0, 0, -limit.IntervalDays)
+	}
+
+	err := updateSuppression(key, func(record *SuppressionRecord) {
+		if record.Evidence != evidence {
+			*record = SuppressionRecord{Evidence: evidence}
+		}
+
+		var shown []time.Time
+		for _, t := range record.Shown {
+			if t.After(since) {
+				shown = append(shown, t)
+			}
+		}
+		record.Shown = append(shown, time.Now())
+	})
+	if err != nil {
+		logger(er.Context.RequestContext, fmt.Errorf("failed to record %s card: %v (patient: %s)", service, err, er.Context.Patient.Id))
+	}
+}
+
+// Snoozes a tenant's card when it is overridden with a reason that the tenant maps to a snooze
+func snoozeCard(config *Config, record FeedbackRecord) error {
+	if record.Outcome != feedbackOverridden || record.OverrideReason == nil || record.OverrideReason.Reason == nil {
+		return nil
+	}
+
+	// Cards issued before cards were recorded can't be snoozed
+	var card CardRecord
+	found, err := getJSON(cardBucket, record.Card, &card)
+	if err != nil || !found {
+		return err
+	}
+
+	if card.Tenant != config.Name {
+		return fmt.Errorf("card %s: %w (%s)", record.Card, errCardTenant, config.Name)
+	}
+	code := record.OverrideReason.Reason.Code
+	days, ok := config.snoozeDays()[code]
+	if !ok || days <= 0 {
+		return nil
+	}
+
+	key := suppressionKey(config, card.Service, card.PatientId, card.UserId)
+	return updateSuppression(key, func(s *SuppressionRecord) {
+		s.SnoozedUntil = record.Received.AddDate(0, 0, days)
+		s.SnoozeReason = code
+	})
+}
+
+// Reads, modifies and writes a suppression record in a single transaction
+func updateSuppression(key string, fn func(*SuppressionRecord)) error {
+	return store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(suppressionBucket))
+
+		var record SuppressionRecord
+		if data := bucket.Get([]byte(key)); data != nil {
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+		}
+
+		fn(&record)
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Security label marking test data, used when a tenant does not configure its own tags
+var testPatientTag = Coding{System: "http://terminology.hl7.org/CodeSystem/v3-ActReason", Code: "HTEST"}
+
+type HumanName struct {
+	Text   string   `json:"text"`
+	Family string   `json:"family"`
+	Given  []string `json:"given"`
+}
+
+// Compiles the pattern matching test patient names
+func (t *TestPatientConfig) compile() error {
+	if t.Names == "" {
+		return nil
+	}
+	var err error
+	t.namesRe, err = regexp.Compile(t.Names)
+	return err
+}
+
+// Returns the tags marking test patients
+func (c *Config) testPatientTags() []Coding {
+	if c.TestPatients == nil || len(c.TestPatients.Tags) == 0 {
+		return []Coding{testPatientTag}
+	}
+	return c.TestPatients.Tags
+}
+
+// Reports whether the patient is a test patient, by ID, identifier system, name or meta tag
+func (er *EligibilityRequest) isTestPatient() bool {
+	patient := er.Context.Patient
+
+	// Check for a tag marking the record as test data
+	for _, tag := range patient.Meta.Tag {
+		for _, t := range er.Config.testPatientTags() {
+			if tag.Code == t.Code && (t.System == "" || tag.System == t.System) {
+				return true
+			}
+		}
+	}
+
+	tp := er.Config.TestPatients
+	if tp == nil {
+		return false
+	}
+
+	// Check for a known test patient
+	if slices.Contains(tp.Ids, patient.Id) {
+		return true
+	}
+
+	// Check for an identifier assigned only to test patients
+	for _, identifier := range patient.Identifier {
+		if slices.Contains(tp.IdentifierSystems, identifier.System) {
+			return true
+		}
+	}
+
+	// Check for a test patient name
+	if tp.namesRe != nil {
+		for _, name := range patient.Name {
+			full := strings.TrimSpace(strings.Join(append(slices.Clone(name.Given), name.Family), " "))
+			if tp.namesRe.MatchString(name.Text) || tp.namesRe.MatchString(full) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
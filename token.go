@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
 )
 
 func parseToken(authHeader string) (*jwt.Token, error) {
@@ -22,6 +24,19 @@ func parseToken(authHeader string) (*jwt.Token, error) {
 	return token, nil
 }
 
+// Returns the issuer of the token stored on the request by the openId middleware, if any
+func requestIssuer(c echo.Context) string {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	issuer, err := getIssuer(token)
+	if err != nil {
+		return ""
+	}
+	return issuer
+}
+
 func getIssuer(token *jwt.Token) (string, error) {
 	var host string
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
@@ -40,3 +55,26 @@ func getIssuer(token *jwt.Token) (string, error) {
 	}
 	return host, nil
 }
+
+// Reports whether the token grants a scope, from a space-separated scope claim or a scp claim
+func hasScope(token *jwt.Token, scope string) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+
+	var scopes []string
+	for _, name := range []string{"scope", "scp"} {
+		switch v := claims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(v)...)
+		case []any:
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+	}
+	return slices.Contains(scopes, scope)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmechov4"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/module/apmzap"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	tracingNone    string = "none"
+	tracingElastic string = "elastic"
+	tracingOTLP    string = "otlp"
+)
+
+var (
+	// Tracing backend, either "elastic" or "otlp". Falls back to the Elastic APM toggle when unset.
+	tracingBackend string = getEnv("TRACING_BACKEND", tracingBackendFromAPM())
+	otelTracer     trace.Tracer
+)
+
+// Common interface for Elastic and OpenTelemetry spans
+type Span interface {
+	End()
+}
+
+type otelSpan struct {
+	trace.Span
+}
+
+func (s otelSpan) End() {
+	s.Span.End()
+}
+
+func tracingBackendFromAPM() string {
+	if apmActive == "true" {
+		return tracingElastic
+	}
+	return tracingNone
+}
+
+// Configures the selected tracing backend and returns a function to flush it on shutdown
+func initTracing(e *echo.Echo) func(context.Context) error {
+	// Close default Elastic APM tracer
+	zapLogger.Info("Disable default APM logger")
+	apm.DefaultTracer.Close()
+
+	switch tracingBackend {
+	case tracingElastic:
+		return initElasticTracing(e)
+	case tracingOTLP:
+		return initOTLPTracing(e)
+	}
+
+	return func(context.Context) error { return nil }
+}
+
+func initElasticTracing(e *echo.Echo) func(context.Context) error {
+	// Create new tracer with basic options
+	// Use environment variables for the remaining options
+	zapLogger.Info("Creating new APM tracer",
+		zap.String("ServiceName", appName),
+		zap.String("ServiceEnvironment", appEnv))
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
+		ServiceName:        appName,
+		ServiceEnvironment: appEnv,
+	})
+	if err != nil {
+		zapLogger.Fatal(err.Error())
+	}
+
+	// Adds elastic APM middleware to web server to capture requests
+	// and send them to elastic
+	zapLogger.Info("Enabling APM logger")
+	e.Use(apmechov4.Middleware(apmechov4.WithTracer(tracer)))
+
+	return func(context.Context) error {
+		tracer.Flush(nil)
+		tracer.Close()
+		return nil
+	}
+}
+
+func initOTLPTracing(e *echo.Echo) func(context.Context) error {
+	// Create OTLP exporter. Endpoint and headers are read from the standard OTEL_EXPORTER_OTLP_*
+	// environment variables.
+	zapLogger.Info("Creating new OpenTelemetry tracer",
+		zap.String("ServiceName", appName),
+		zap.String("ServiceEnvironment", appEnv))
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		zapLogger.Fatal(err.Error())
+	}
+
+	// Describe this service on every span
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(appName),
+		semconv.ServiceVersion(appVersion),
+		semconv.DeploymentEnvironment(appEnv),
+	))
+	if err != nil {
+		zapLogger.Fatal(err.Error())
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	// Propagate W3C trace context on incoming and outgoing requests
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otelTracer = provider.Tracer(appName)
+
+	// Adds OpenTelemetry middleware to web server to capture requests
+	zapLogger.Info("Enabling OpenTelemetry tracing")
+	e.Use(otelecho.Middleware(appName, otelecho.WithTracerProvider(provider)))
+
+	return provider.Shutdown
+}
+
+// Starts a span on the active tracing backend. The returned context carries the new span.
+func startSpan(ctx context.Context, name, spanType string) (Span, context.Context) {
+	switch tracingBackend {
+	case tracingOTLP:
+		ctx, span := otelTracer.Start(ctx, name+": "+spanType, trace.WithAttributes(
+			attribute.String("span.type", spanType),
+		))
+		return otelSpan{span}, ctx
+	default:
+		span, ctx := apm.StartSpan(ctx, name, spanType)
+		return span, ctx
+	}
+}
+
+// Reports an error against the current trace
+func captureError(ctx context.Context, err error) {
+	switch tracingBackend {
+	case tracingElastic:
+		apm.CaptureError(ctx, err).Send()
+	case tracingOTLP:
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Returns log fields identifying the current trace and span
+func traceFields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+
+	switch tracingBackend {
+	case tracingElastic:
+		return apmzap.TraceContext(ctx)
+	case tracingOTLP:
+		sc := trace.SpanContextFromContext(ctx)
+		if !sc.IsValid() {
+			return nil
+		}
+		return []zap.Field{
+			zap.String("trace.id", sc.TraceID().String()),
+			zap.String("span.id", sc.SpanID().String()),
+		}
+	}
+	return nil
+}
+
+// Wraps an HTTP client so outbound requests carry the trace context of the request context.
+// Requests made outside of a trace (e.g. log shipping) are left untouched.
+func traceClient(ctx context.Context, client *http.Client) *http.Client {
+	switch tracingBackend {
+	case tracingElastic:
+		if apm.TransactionFromContext(ctx) == nil {
+			return client
+		}
+		return apmhttp.WrapClient(client)
+	case tracingOTLP:
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return client
+		}
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		client.Transport = otelhttp.NewTransport(transport)
+	}
+	return client
+}